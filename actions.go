@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// actionEnv is what picker actions need besides the selection.
+type actionEnv struct {
+	Cfg    *Config
+	Launch launchOptions
+}
+
+// action is something the picker can do with the selected app. Key is the
+// fzf key that triggers it; "" is enter. An action without Run is handled
+// inside fzf by a --bind the picker adds, and is only listed when it does.
+type action struct {
+	Key  string
+	Hint string
+	Run  func(ctx context.Context, env actionEnv, sel selection) int
+}
+
+// actions are the picker's key bindings, in header order. Adding an entry
+// here is enough: the --expect argument and the header hints are built
+// from this list.
+var actions = []action{
+	{"", "launch", runLaunch},
+	{"ctrl-s", "app settings", func(ctx context.Context, env actionEnv, sel selection) int {
+		return openSettings(ctx, sel.Pkg)
+	}},
+	{"ctrl-y", "copy launch command", runCopy},
+	{"ctrl-o", "print intent URI", func(ctx context.Context, env actionEnv, sel selection) int {
+		fmt.Println(intentURI(sel.Pkg, sel.Main))
+		return 0
+	}},
+	{toggleSystemKey, "system apps", nil},
+}
+
+// findAction returns the action bound to key, or nil.
+func findAction(key string) *action {
+	for i := range actions {
+		if actions[i].Key == key {
+			return &actions[i]
+		}
+	}
+	return nil
+}
+
+// expectArg is the fzf --expect option for every bound key.
+func expectArg() string {
+	var keys []string
+	for _, a := range actions {
+		if a.Key != "" && a.Run != nil {
+			keys = append(keys, a.Key)
+		}
+	}
+	return "--expect=" + strings.Join(keys, ",")
+}
+
+// headerHint lists the bindings for the picker header. enterHint replaces
+// the hint of the enter action when set; binds are the extra fzf options,
+// which tell whether the actions fzf handles itself are bound.
+func headerHint(enterHint string, binds []string) string {
+	var hints []string
+	for _, a := range actions {
+		if a.Run == nil && !slices.ContainsFunc(binds, func(b string) bool {
+			return strings.HasPrefix(b, "--bind="+a.Key+":")
+		}) {
+			continue
+		}
+		key, hint := a.Key, a.Hint
+		if key == "" {
+			key = "enter"
+			if enterHint != "" {
+				hint = enterHint
+			}
+		}
+		hints = append(hints, key+": "+hint)
+	}
+	return strings.Join(hints, ", ")
+}
+
+func runLaunch(ctx context.Context, env actionEnv, sel selection) int {
+	if err := launchApp(ctx, sel.Pkg, sel.Main, env.Launch); err != nil {
+		return reportLaunchFailure(env.Cfg, sel.Pkg, err)
+	}
+	if err := recordLaunch(sel.Pkg); err != nil {
+		fmt.Fprintln(os.Stderr, "cannot save launch history:", err)
+	}
+	return 0
+}
+
+func runCopy(ctx context.Context, env actionEnv, sel selection) int {
+	c := launchCommand(sel.Pkg, sel.Main)
+	if err := copyToClipboard(ctx, c); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "copied:", c)
+	return 0
+}
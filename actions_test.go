@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHeaderHintBoundKeys(t *testing.T) {
+	hint := toggleSystemKey + ": system apps"
+	if h := headerHint("", nil); strings.Contains(h, hint) {
+		t.Errorf("header %q lists %s without its binding", h, toggleSystemKey)
+	}
+	binds := []string{"--bind=" + toggleSystemKey + ":reload:drawercli --toggle-system"}
+	if h := headerHint("", binds); !strings.HasSuffix(h, ", "+hint) {
+		t.Errorf("header %q does not list %s", h, toggleSystemKey)
+	}
+	if h := headerHint("launch or open folder", nil); !strings.HasPrefix(h, "enter: launch or open folder, ") {
+		t.Errorf("header %q does not use the enter hint", h)
+	}
+}
+
+func TestExpectArgMatchesActions(t *testing.T) {
+	arg, ok := strings.CutPrefix(expectArg(), "--expect=")
+	if !ok {
+		t.Fatalf("expectArg() = %q", expectArg())
+	}
+	keys := strings.Split(arg, ",")
+	seen := map[string]bool{}
+	for _, k := range keys {
+		a := findAction(k)
+		if a == nil || a.Run == nil {
+			t.Errorf("--expect lists %q, which runs no action", k)
+		}
+		if seen[k] {
+			t.Errorf("--expect lists %q twice", k)
+		}
+		seen[k] = true
+	}
+	for _, a := range actions {
+		if a.Key != "" && a.Run != nil && !seen[a.Key] {
+			t.Errorf("action %q (%s) is missing from --expect", a.Key, a.Hint)
+		}
+		if a.Key != "" && a.Run == nil && seen[a.Key] {
+			t.Errorf("%q is bound inside fzf but also expected", a.Key)
+		}
+	}
+	if findAction("") == nil {
+		t.Error("no action for enter")
+	}
+}
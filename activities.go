@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// bulkLaunchers finds launcher activities for all packages at once using
+// the named strategy and returns them keyed by package. Packages missing
+// from the result are resolved one by one during probing; the "resolve"
+// strategy returns nil so that every package is.
+func bulkLaunchers(ctx context.Context, strategy string) (map[string]string, error) {
+	switch strategy {
+	case "resolve":
+		return nil, nil
+	case "query":
+		qctx, cancel := withTimeout(ctx, 15*time.Second)
+		defer cancel()
+		acts, err := queryIntent(qctx, launcherIntent...)
+		if err != nil {
+			return nil, err
+		}
+		launchers := make(map[string]string, len(acts))
+		for pkg, a := range acts {
+			launchers[pkg] = a[0]
+		}
+		return launchers, nil
+	case "dumpsys":
+		dctx, cancel := withTimeout(ctx, 15*time.Second)
+		defer cancel()
+		out, err := runCmd(dctx, "dumpsys", "package", "resolvers", "activity")
+		if err != nil {
+			return nil, err
+		}
+		return parseResolverTable(out), nil
+	default:
+		return nil, fmt.Errorf("unknown strategy %q", strategy)
+	}
+}
+
+// parseResolverTable extracts MAIN/LAUNCHER activities from the activity
+// resolver dump of `dumpsys package`. Each filter entry looks like
+//
+//	5c3a5b2 com.foo/.MainActivity filter 9b1c3d
+//	  Action: "android.intent.action.MAIN"
+//	  Category: "android.intent.category.LAUNCHER"
+//
+// The first launcher activity seen for a package wins.
+func parseResolverTable(out string) map[string]string {
+	launchers := map[string]string{}
+	var pkg, cls string
+	var isMain, isLauncher bool
+	flush := func() {
+		if pkg != "" && isMain && isLauncher {
+			if _, ok := launchers[pkg]; !ok {
+				launchers[pkg] = cls
+			}
+		}
+		pkg, cls, isMain, isLauncher = "", "", false, false
+	}
+
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		l := strings.TrimFunc(sc.Text(), isJunk)
+		f := strings.Fields(l)
+		switch {
+		case len(f) >= 3 && f[2] == "filter" && strings.Contains(f[1], "/"):
+			flush()
+			pkg, cls, _ = splitComponent(f[1])
+		case strings.HasPrefix(l, "Action: "):
+			isMain = isMain || strings.Contains(l, `"android.intent.action.MAIN"`)
+		case strings.HasPrefix(l, "Category: "):
+			isLauncher = isLauncher || strings.Contains(l, `"android.intent.category.LAUNCHER"`)
+		}
+	}
+	flush()
+	return launchers
+}
+
+// launcherIntent is the intent spec home screens resolve apps with.
+var launcherIntent = []string{"-a", "android.intent.action.MAIN", "-c", "android.intent.category.LAUNCHER"}
+
+// queryIntent runs query-activities for an am-style intent spec and
+// returns the matching activities per package.
+func queryIntent(ctx context.Context, intent ...string) (map[string][]string, error) {
+	args := append([]string{"package", "query-activities", "--brief", "--user", androidUser}, intent...)
+	out, err := runCmd(ctx, "cmd", args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseQueryActivityList(out), nil
+}
+
+// queryActivities lists the launcher activities of one package with
+// query-activities, which returns every match rather than picking one.
+func queryActivities(ctx context.Context, pkg string) []string {
+	acts, err := queryIntent(ctx, append(launcherIntent, pkg)...)
+	if err != nil {
+		return nil
+	}
+	return acts[pkg]
+}
+
+// mimeHandlers returns the packages with an activity that can view or
+// receive a share of the given MIME type.
+func mimeHandlers(ctx context.Context, mime string) (map[string]bool, error) {
+	handlers := map[string]bool{}
+	for _, action := range []string{"android.intent.action.VIEW", "android.intent.action.SEND"} {
+		acts, err := queryIntent(ctx, "-a", action, "-t", mime)
+		if err != nil {
+			return nil, err
+		}
+		for pkg := range acts {
+			handlers[pkg] = true
+		}
+	}
+	return handlers, nil
+}
+
+// queryMain returns the first launcher activity of pkg, or "".
+func queryMain(ctx context.Context, pkg string) string {
+	if acts := queryActivities(ctx, pkg); len(acts) > 0 {
+		return acts[0]
+	}
+	return ""
+}
+
+// resolverActivities are the system pickers resolve-activity may return
+// instead of an app's own activity when the intent matches more than one.
+var resolverActivities = map[string]bool{
+	"com.android.internal.app.ResolverActivity":          true,
+	"com.android.internal.app.ChooserActivity":           true,
+	"com.android.internal.app.IntentForwarderActivity":   true,
+	"com.android.intentresolver.ChooserActivity":         true,
+	"com.android.intentresolver.ResolverActivity":        true,
+	"com.huawei.android.internal.app.HwResolverActivity": true,
+}
+
+// isResolverActivity reports whether cls is a resolver or chooser rather
+// than a real launch target. OEM variants are matched by name suffix.
+func isResolverActivity(cls string) bool {
+	if resolverActivities[cls] {
+		return true
+	}
+	simple := cls[strings.LastIndex(cls, ".")+1:]
+	return strings.HasSuffix(simple, "ResolverActivity") || strings.HasSuffix(simple, "ChooserActivity")
+}
+
+// parseQueryActivityList reads the --brief output of `cmd package
+// query-activities`, where each match ends with its component on a line of
+// its own:
+//
+//	Activity #0:
+//	  priority=0 preferredOrder=0 match=0x108000 specificIndex=-1 isDefault=false
+//	  com.foo/.MainActivity
+//
+// Activities are returned per package in the order listed, which is
+// highest priority first.
+func parseQueryActivityList(out string) map[string][]string {
+	acts := map[string][]string{}
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		l := strings.TrimFunc(sc.Text(), isJunk)
+		if strings.ContainsAny(l, " \t=") {
+			continue
+		}
+		pkg, cls, ok := splitComponent(l)
+		if !ok || !isPackageName(pkg) {
+			continue
+		}
+		acts[pkg] = append(acts[pkg], cls)
+	}
+	return acts
+}
+
+// splitComponent splits a flattened component name ("pkg/cls") and expands
+// a class given relative to the package (".Main") to its full name.
+func splitComponent(c string) (pkg, cls string, ok bool) {
+	pkg, cls, ok = strings.Cut(c, "/")
+	if !ok || pkg == "" || cls == "" {
+		return "", "", false
+	}
+	return pkg, qualifyActivity(pkg, cls), true
+}
+
+// qualifyActivity returns the fully-qualified class name of an activity of
+// pkg. It accepts a full name, a name relative to the package (".Main" or
+// a bare "Main"), or a whole "pkg/cls" component.
+func qualifyActivity(pkg, cls string) string {
+	cls = strings.TrimSpace(cls)
+	if p, c, ok := strings.Cut(cls, "/"); ok {
+		if p != "" {
+			pkg = p
+		}
+		cls = c
+	}
+	switch {
+	case cls == "" || cls == "UNKNOWN_MAIN":
+		return cls
+	case strings.HasPrefix(cls, "."):
+		return pkg + cls
+	case !strings.Contains(cls, "."):
+		return pkg + "." + cls
+	}
+	return cls
+}
+
+// printComponent prints the launch component of pkg in the "pkg/activity"
+// form `am start -n` takes, for --resolve.
+func printComponent(ctx context.Context, cfg *Config, pkg string) int {
+	rctx, cancel := withTimeout(ctx, 4*time.Second)
+	defer cancel()
+	main, err := resolveMain(rctx, pkg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	a := &AppInfo{Package: pkg, Main: qualifyActivity(pkg, main)}
+	cfg.overrideMain(a)
+	main = a.Main
+	if main == "" {
+		fmt.Fprintf(os.Stderr, "%s: no launcher activity\n", pkg)
+		return 1
+	}
+	fmt.Printf("%s/%s\n", pkg, main)
+	return 0
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resolverDump is the activity resolver section of `dumpsys package r
+// activity`, trimmed.
+const resolverDump = `Activity Resolver Table:
+  Full MIME Types:
+      image/*:
+        7d2c1a0 com.android.gallery3d/.app.GalleryActivity filter 3f1b2d4
+          Action: "android.intent.action.VIEW"
+          Category: "android.intent.category.DEFAULT"
+          Type: "image/*"
+
+  Non-Data Actions:
+      android.intent.action.MAIN:
+        5c3a5b2 com.termux/.app.TermuxActivity filter 9b1c3d
+          Action: "android.intent.action.MAIN"
+          Category: "android.intent.category.LAUNCHER"
+        1a2b3c4 com.termux/.app.TermuxActivity filter 4d5e6f
+          Action: "android.intent.action.MAIN"
+          Category: "android.intent.category.LEANBACK_LAUNCHER"
+        2b3c4d5 com.android.settings/.Settings filter 5e6f70
+          Action: "android.intent.action.MAIN"
+          Category: "android.intent.category.DEFAULT"
+          Category: "android.intent.category.LAUNCHER"
+          mPriority=1, mOrder=0, mHasStaticPartialTypes=false
+        3c4d5e6 com.android.settings/com.android.settings.SubSettings filter 6f7081
+          Action: "android.intent.action.MAIN"
+          Category: "android.intent.category.LAUNCHER"
+        4d5e6f7 com.android.launcher3/.Launcher filter 708192
+          Action: "android.intent.action.MAIN"
+          Category: "android.intent.category.HOME"
+        6f708a9 org.example.alias/.Launcher filter 8192a3
+          Action: "android.intent.action.MAIN"
+          Action: "android.intent.action.VIEW"
+          Category: "android.intent.category.DEFAULT"
+          Category: "android.intent.category.LAUNCHER"
+`
+
+func TestParseResolverTable(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want map[string]string
+	}{
+		{
+			name: "dump",
+			out:  resolverDump,
+			want: map[string]string{
+				"com.termux":           "com.termux.app.TermuxActivity",
+				"com.android.settings": "com.android.settings.Settings",
+				"org.example.alias":    "org.example.alias.Launcher",
+			},
+		},
+		{
+			name: "crlf",
+			out: "  8a7b com.foo/.Main filter 1\r\n" +
+				"    Action: \"android.intent.action.MAIN\"\r\n" +
+				"    Category: \"android.intent.category.LAUNCHER\"\r\n",
+			want: map[string]string{"com.foo": "com.foo.Main"},
+		},
+		{
+			name: "category before action",
+			out: "  8a7b com.foo/.Main filter 1\n" +
+				"    Category: \"android.intent.category.LAUNCHER\"\n" +
+				"    Action: \"android.intent.action.MAIN\"\n",
+			want: map[string]string{"com.foo": "com.foo.Main"},
+		},
+		{
+			name: "launcher without main",
+			out: "  8a7b com.foo/.Main filter 1\n" +
+				"    Action: \"android.intent.action.VIEW\"\n" +
+				"    Category: \"android.intent.category.LAUNCHER\"\n" +
+				"  9c8d com.bar/.Main filter 2\n" +
+				"    Action: \"android.intent.action.MAIN\"\n",
+			want: map[string]string{},
+		},
+		{
+			name: "empty",
+			out:  "",
+			want: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseResolverTable(tt.out); !maps.Equal(got, tt.want) {
+				t.Errorf("parseResolverTable = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeResolverDump is a resolver table with a launcher entry for each of
+// n packages com.example.app<i>.
+func fakeResolverDump(n int) string {
+	var sb strings.Builder
+	sb.WriteString("Activity Resolver Table:\n  Non-Data Actions:\n      android.intent.action.MAIN:\n")
+	for i := range n {
+		fmt.Fprintf(&sb, "        %07x com.example.app%d/.MainActivity filter %07x\n", i, i, i+1)
+		sb.WriteString("          Action: \"android.intent.action.MAIN\"\n")
+		sb.WriteString("          Category: \"android.intent.category.LAUNCHER\"\n")
+		sb.WriteString("          mPriority=0, mOrder=0, mHasStaticPartialTypes=false\n")
+	}
+	return sb.String()
+}
+
+func BenchmarkParseResolverTable(b *testing.B) {
+	out := fakeResolverDump(500)
+	b.SetBytes(int64(len(out)))
+	b.ResetTimer()
+	for range b.N {
+		if n := len(parseResolverTable(out)); n != 500 {
+			b.Fatalf("parsed %d launchers", n)
+		}
+	}
+}
+
+// cmdLatency stands in for the cost of starting pm or dumpsys on a
+// device, where each command is a new app_process.
+const cmdLatency = 2 * time.Millisecond
+
+// BenchmarkLauncherStrategies compares finding the launcher activities of
+// n packages with one dumpsys call against a pm resolve-activity per
+// package, run probeLimit at a time as probeAll does, when every command
+// costs cmdLatency.
+func BenchmarkLauncherStrategies(b *testing.B) {
+	old := runner
+	b.Cleanup(func() { runner = old })
+	for _, n := range []int{50, 200, 800} {
+		dump := fakeResolverDump(n)
+		pkgs := make([]string, n)
+		for i := range pkgs {
+			pkgs[i] = fmt.Sprintf("com.example.app%d", i)
+		}
+		r := &fakeRunner{fn: func(ctx context.Context, name string, args []string) (string, string, error) {
+			time.Sleep(cmdLatency)
+			if name == "dumpsys" {
+				return dump, "", nil
+			}
+			return "  name=" + args[len(args)-1] + ".MainActivity\n", "", nil
+		}}
+		runner = r
+
+		b.Run(fmt.Sprintf("dumpsys/n=%d", n), func(b *testing.B) {
+			for range b.N {
+				launchers, err := bulkLaunchers(context.Background(), "dumpsys")
+				if err != nil || len(launchers) != n {
+					b.Fatalf("got %d launchers, %v", len(launchers), err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("resolve/n=%d", n), func(b *testing.B) {
+			for range b.N {
+				found := make([]string, n)
+				sem := make(chan struct{}, probeLimit())
+				var wg sync.WaitGroup
+				for i, pkg := range pkgs {
+					sem <- struct{}{}
+					wg.Add(1)
+					go func() {
+						defer func() {
+							<-sem
+							wg.Done()
+						}()
+						found[i], _ = resolveMain(context.Background(), pkg)
+					}()
+				}
+				wg.Wait()
+				if found[n-1] == "" {
+					b.Fatal("resolveMain found nothing")
+				}
+			}
+		})
+	}
+}
+
+func TestIsResolverActivity(t *testing.T) {
+	for _, cls := range []string{
+		"com.android.internal.app.ResolverActivity",
+		"com.android.internal.app.ChooserActivity",
+		"com.android.intentresolver.ChooserActivity",
+		"com.huawei.android.internal.app.HwResolverActivity",
+		"com.miui.internal.app.MiuiResolverActivity",
+		"com.oplus.resolver.OplusChooserActivity",
+	} {
+		if !isResolverActivity(cls) {
+			t.Errorf("isResolverActivity(%q) = false", cls)
+		}
+	}
+	for _, cls := range []string{
+		"com.termux.app.TermuxActivity",
+		"com.example.ResolverActivityHelper",
+		"com.example.resolver.MainActivity",
+		"ResolverActivityX",
+		"",
+	} {
+		if isResolverActivity(cls) {
+			t.Errorf("isResolverActivity(%q) = true", cls)
+		}
+	}
+}
+
+func TestResolveMainSkipsResolver(t *testing.T) {
+	r := &fakeRunner{fn: func(ctx context.Context, name string, args []string) (string, string, error) {
+		switch {
+		case name == "pm" && args[0] == "resolve-activity":
+			return "priority=0 preferredOrder=0 match=0x0\n" +
+				"  name=com.android.internal.app.ResolverActivity\n" +
+				"  packageName=android\n", "", nil
+		case name == "cmd" && args[1] == "query-activities":
+			return "Activity #0:\n  priority=0 preferredOrder=0 match=0x108000\n  com.twin/.FirstLauncher\n" +
+				"Activity #1:\n  priority=0 preferredOrder=0 match=0x108000\n  com.twin/.SecondLauncher\n", "", nil
+		}
+		return "", "", fmt.Errorf("unexpected %s %q", name, args)
+	}}
+	useRunner(t, r)
+	got, err := resolveMain(context.Background(), "com.twin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "com.twin.FirstLauncher" {
+		t.Errorf("resolveMain = %q, want the first launcher activity instead of the chooser", got)
+	}
+	if len(r.called("cmd package query-activities")) != 1 {
+		t.Errorf("commands = %q, want one query-activities after the chooser", r.calls)
+	}
+}
+
+func TestQualifyActivity(t *testing.T) {
+	tests := []struct{ pkg, cls, want string }{
+		{"com.foo", ".MainActivity", "com.foo.MainActivity"},
+		{"com.foo", ".ui.Main", "com.foo.ui.Main"},
+		{"com.foo", "MainActivity", "com.foo.MainActivity"},
+		{"com.foo", "com.foo.MainActivity", "com.foo.MainActivity"},
+		{"com.foo", "org.lib.SharedActivity", "org.lib.SharedActivity"},
+		{"com.foo", "com.foo/.MainActivity", "com.foo.MainActivity"},
+		{"com.foo", "com.foo/com.foo.MainActivity", "com.foo.MainActivity"},
+		{"com.foo", "com.bar/.Other", "com.bar.Other"},
+		{"com.foo", "/.MainActivity", "com.foo.MainActivity"},
+		{"com.foo", "  .MainActivity\n", "com.foo.MainActivity"},
+		{"com.foo", "", ""},
+		{"com.foo", "UNKNOWN_MAIN", "UNKNOWN_MAIN"},
+	}
+	for _, tt := range tests {
+		if got := qualifyActivity(tt.pkg, tt.cls); got != tt.want {
+			t.Errorf("qualifyActivity(%q, %q) = %q, want %q", tt.pkg, tt.cls, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// BadgingInfo is what the drawer reads from `aapt dump badging` output.
+// Fields aapt did not print are empty.
+type BadgingInfo struct {
+	// OK is set when there was badging output to parse.
+	OK bool
+	// Label is the label chosen for the locale given to parseBadging;
+	// Labels has every label by locale, "" for the default.
+	Label  string
+	Labels map[string]string
+	// Icon is the icon resource path.
+	Icon string
+	// VersionCode and VersionName come from the package: line.
+	VersionCode string
+	VersionName string
+	// SDK and TargetSDK are the minimum and target API levels.
+	SDK       string
+	TargetSDK string
+	// Permissions are the requested permissions in output order.
+	Permissions []string
+}
+
+// parseBadging extracts every field the drawer uses from aapt badging
+// output in one pass, e.g.
+//
+//	package: name='com.foo' versionCode='42' versionName='1.2'
+//	sdkVersion:'24'
+//	targetSdkVersion:'34'
+//	uses-permission: name='android.permission.INTERNET'
+//	application-label:'Foo'
+//	application-label-de:'Föö'
+//	application-icon-160:'res/mipmap-mdpi/ic_launcher.png'
+//	application: label='Foo' icon='res/mipmap/ic_launcher.png'
+//
+// Labels holds one label per locale variant ("" for the default). Quotes
+// inside a label are not escaped, so the value runs to the last quote on
+// the line; a line with no closing quote wraps onto the next lines, which
+// are joined with spaces up to the closing quote, the next badging entry
+// or maxLabelLines. Without an application-label line the label= of the
+// application: line is the default. Icon is the icon= of the application:
+// line or else the first application-icon-<dpi> line. locale selects
+// Label as chooseLabel does.
+func parseBadging(out, locale string) BadgingInfo {
+	b := BadgingInfo{OK: out != "", Labels: map[string]string{}}
+	appLabel, appIcon, dpiIcon := "", "", ""
+	lines := strings.Split(out, "\n")
+	for i := 0; i < len(lines); i++ {
+		l := strings.TrimFunc(lines[i], isJunk)
+		key, val, _ := strings.Cut(l, ":")
+		switch {
+		case key == "package":
+			b.VersionCode = badgingAttr(l, "versionCode")
+			b.VersionName = badgingAttr(l, "versionName")
+		case key == "sdkVersion":
+			b.SDK = quotedValue(val)
+		case key == "targetSdkVersion":
+			b.TargetSDK = quotedValue(val)
+		case key == "uses-permission":
+			if p := permission(val); p != "" && !slices.Contains(b.Permissions, p) {
+				b.Permissions = append(b.Permissions, p)
+			}
+		case key == "application":
+			if appLabel == "" {
+				appLabel = badgingAttr(l, "label")
+			}
+			if appIcon == "" {
+				appIcon = badgingAttr(l, "icon")
+			}
+		case strings.HasPrefix(key, "application-icon-"):
+			if dpiIcon == "" {
+				dpiIcon = quotedValue(val)
+			}
+		case key == "application-label" || strings.HasPrefix(key, "application-label-"):
+			var label string
+			label, i = labelValue(lines, i, val)
+			loc := strings.TrimPrefix(strings.TrimPrefix(key, "application-label"), "-")
+			if _, dup := b.Labels[loc]; !dup {
+				b.Labels[loc] = label
+			}
+		}
+	}
+	if b.Labels[""] == "" && appLabel != "" {
+		b.Labels[""] = appLabel
+	}
+	b.Label = chooseLabel(b.Labels, locale)
+	b.Icon = appIcon
+	if b.Icon == "" {
+		b.Icon = dpiIcon
+	}
+	return b
+}
+
+// maxLabelLines caps how many lines a label without a closing quote may
+// take, so a stray quote cannot swallow the rest of the output.
+const maxLabelLines = 4
+
+// labelValue decodes the label val that starts on lines[i], joining the
+// lines a label without a closing quote wraps onto, and returns it with
+// the index of its last line.
+func labelValue(lines []string, i int, val string) (string, int) {
+	val = strings.TrimSpace(val)
+	v, ok := strings.CutPrefix(val, "'")
+	if !ok {
+		return unescapeAapt(val), i
+	}
+	end := strings.LastIndex(v, "'")
+	for n := 1; end < 0 && n < maxLabelLines && i+1 < len(lines); n++ {
+		next := strings.TrimFunc(lines[i+1], isJunk)
+		if isBadgingEntry(next) {
+			break
+		}
+		i++
+		v += " " + next
+		end = strings.LastIndex(v, "'")
+	}
+	if end >= 0 {
+		v = v[:end]
+	}
+	return unescapeAapt(v), i
+}
+
+// permission returns the permission of a uses-permission: line after the
+// colon, in either form
+//
+//	uses-permission: name='android.permission.INTERNET'
+//	uses-permission:'android.permission.INTERNET'
+func permission(val string) string {
+	if name := badgingAttr(val, "name"); name != "" {
+		return name
+	}
+	if strings.HasPrefix(strings.TrimSpace(val), "'") {
+		return quotedValue(val)
+	}
+	return ""
+}
+
+// badgingAttr returns the value of a key='value' attribute on a badging
+// line, or "".
+func badgingAttr(line, key string) string {
+	_, v, ok := strings.Cut(line, " "+key+"='")
+	if !ok {
+		return ""
+	}
+	if end := attrEnd(v); end >= 0 {
+		return unescapeAapt(v[:end])
+	}
+	return ""
+}
+
+// attrEnd returns the index of the quote closing an attribute value that
+// starts s. aapt does not escape quotes inside values, so a quote only
+// closes the value when the line ends after it or the next key='...'
+// attribute follows; label='Grandma's Recipes' icon='...' keeps its
+// apostrophe. Without such a quote it falls back to the last one, or -1.
+func attrEnd(s string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\'' {
+			continue
+		}
+		rest := s[i+1:]
+		if strings.TrimSpace(rest) == "" || startsAttr(rest) {
+			return i
+		}
+	}
+	return strings.LastIndex(s, "'")
+}
+
+// startsAttr reports whether s begins with " key='".
+func startsAttr(s string) bool {
+	s, ok := strings.CutPrefix(s, " ")
+	if !ok {
+		return false
+	}
+	key, _, ok := strings.Cut(s, "='")
+	if !ok || key == "" {
+		return false
+	}
+	for _, r := range key {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// quotedValue returns the contents of a single-quoted value such as
+// "'24'", or s trimmed if it is not quoted.
+func quotedValue(s string) string {
+	s = strings.TrimSpace(s)
+	if v, ok := strings.CutPrefix(s, "'"); ok {
+		if end := strings.LastIndex(v, "'"); end >= 0 {
+			return unescapeAapt(v[:end])
+		}
+	}
+	return s
+}
+
+// isBadgingEntry reports whether l starts a new badging entry such as
+// "sdkVersion:'24'" or "uses-permission: name=...", rather than continuing
+// a wrapped label.
+func isBadgingEntry(l string) bool {
+	key, _, ok := strings.Cut(l, ":")
+	if !ok || key == "" {
+		return false
+	}
+	if key[0] < 'a' || key[0] > 'z' {
+		return false
+	}
+	for _, r := range key {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// chooseLabel picks the label for locale (such as "de" or "pt_BR") from
+// BadgingInfo.Labels: an exact locale match, then the plain language,
+// then another region of the same language in sorted order, and finally
+// the default label.
+func chooseLabel(labels map[string]string, locale string) string {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if locale != "" {
+		lang, _, _ := strings.Cut(locale, "-")
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		best, rank := "", 0
+		for _, k := range keys {
+			lk := strings.ToLower(k)
+			klang, _, _ := strings.Cut(lk, "-")
+			r := 0
+			switch {
+			case lk == locale:
+				r = 3
+			case lk == lang:
+				r = 2
+			case klang == lang && k != "":
+				r = 1
+			}
+			if r > rank && labels[k] != "" {
+				best, rank = labels[k], r
+			}
+		}
+		if best != "" {
+			return best
+		}
+	}
+	return labels[""]
+}
+
+// unescapeAapt decodes the escapes aapt may use when printing strings
+// (\uXXXX, surrogate pairs, octal bytes, quotes) and repairs invalid UTF-8
+// so that CJK, RTL and emoji labels render as text in fzf.
+func unescapeAapt(s string) string {
+	if !strings.Contains(s, "\\") {
+		return strings.ToValidUTF8(s, "\uFFFD")
+	}
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 >= len(s) {
+			b = append(b, c)
+			continue
+		}
+		i++
+		switch e := s[i]; e {
+		case 'u':
+			r, n := decodeHexRune(s[i+1:])
+			if n == 0 {
+				b = append(b, '\\', 'u')
+				continue
+			}
+			i += n
+			if utf16.IsSurrogate(r) && strings.HasPrefix(s[i+1:], `\u`) {
+				if lo, m := decodeHexRune(s[i+3:]); m > 0 {
+					if pair := utf16.DecodeRune(r, lo); pair != utf8.RuneError {
+						r = pair
+						i += 2 + m
+					}
+				}
+			}
+			b = utf8.AppendRune(b, r)
+		case 'n', 't':
+			// keep labels on one fzf line
+			b = append(b, ' ')
+		case '0', '1', '2', '3':
+			if i+2 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) {
+				b = append(b, (e-'0')<<6|(s[i+1]-'0')<<3|(s[i+2]-'0'))
+				i += 2
+			} else {
+				b = append(b, e)
+			}
+		default:
+			// \' \" \\ and anything unknown: keep the escaped char
+			b = append(b, e)
+		}
+	}
+	return strings.ToValidUTF8(string(b), "\uFFFD")
+}
+
+func decodeHexRune(s string) (rune, int) {
+	if len(s) < 4 {
+		return 0, 0
+	}
+	v, err := strconv.ParseUint(s[:4], 16, 32)
+	if err != nil {
+		return 0, 0
+	}
+	return rune(v), 4
+}
+
+func isOctal(c byte) bool {
+	return c >= '0' && c <= '7'
+}
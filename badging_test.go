@@ -0,0 +1,254 @@
+package main
+
+import (
+	"maps"
+	"reflect"
+	"testing"
+)
+
+// termuxBadging is `aapt dump badging` output for Termux 0.118, trimmed
+// to a few locales.
+const termuxBadging = `package: name='com.termux' versionCode='118' versionName='0.118.0' compileSdkVersion='28' compileSdkVersionCodename='9'
+sdkVersion:'24'
+targetSdkVersion:'28'
+uses-permission: name='android.permission.INTERNET'
+uses-permission: name='android.permission.WAKE_LOCK'
+uses-permission: name='android.permission.VIBRATE'
+uses-permission: name='android.permission.FOREGROUND_SERVICE'
+application-label:'Termux'
+application-label-de:'Termux'
+application-label-ja:'ターミナル'
+application-icon-160:'res/mipmap-mdpi-v4/ic_launcher.png'
+application-icon-240:'res/mipmap-hdpi-v4/ic_launcher.png'
+application-icon-65535:'res/mipmap-anydpi-v26/ic_launcher.xml'
+application: label='Termux' icon='res/mipmap-anydpi-v26/ic_launcher.xml' banner='res/drawable/banner.png'
+application-debuggable
+launchable-activity: name='com.termux.app.TermuxActivity'  label='Termux' icon=''
+leanback-launchable-activity: name='com.termux.app.TermuxActivity'  label='Termux' icon='' banner=''
+uses-feature-not-required: name='android.hardware.touchscreen'
+feature-group: label=''
+  uses-feature: name='android.hardware.faketouch'
+  uses-implied-feature: name='android.hardware.faketouch' reason='default feature for all apps'
+main
+other-activities
+other-services
+supports-screens: 'small' 'normal' 'large' 'xlarge'
+supports-any-density: 'true'
+locales: '--_--' 'de' 'ja'
+densities: '160' '240' '65535'
+native-code: 'arm64-v8a'
+`
+
+func TestParseBadging(t *testing.T) {
+	tests := []struct {
+		name   string
+		out    string
+		locale string
+		want   BadgingInfo
+	}{
+		{
+			name:   "termux",
+			out:    termuxBadging,
+			locale: "ja_JP",
+			want: BadgingInfo{
+				OK:          true,
+				Label:       "ターミナル",
+				Labels:      map[string]string{"": "Termux", "de": "Termux", "ja": "ターミナル"},
+				Icon:        "res/mipmap-anydpi-v26/ic_launcher.xml",
+				VersionCode: "118",
+				VersionName: "0.118.0",
+				SDK:         "24",
+				TargetSDK:   "28",
+				Permissions: []string{
+					"android.permission.INTERNET",
+					"android.permission.WAKE_LOCK",
+					"android.permission.VIBRATE",
+					"android.permission.FOREGROUND_SERVICE",
+				},
+			},
+		},
+		{
+			// older aapt: quoted permissions, no label on the application:
+			// line and the icon only per density
+			name: "old aapt",
+			out: "package: name='org.example.notes' versionCode='7' versionName='Grandma's 1.0'\r\n" +
+				"sdkVersion:'9'\r\n" +
+				"uses-permission:'android.permission.WRITE_EXTERNAL_STORAGE'\r\n" +
+				"uses-permission:'android.permission.WRITE_EXTERNAL_STORAGE'\r\n" +
+				"application-label:'Grandma's Notes'\r\n" +
+				"application-icon-120:'res/drawable-ldpi/icon.png'\r\n" +
+				"application-icon-160:'res/drawable-mdpi/icon.png'\r\n" +
+				"application: label='' icon=''\r\n",
+			want: BadgingInfo{
+				OK:          true,
+				Label:       "Grandma's Notes",
+				Labels:      map[string]string{"": "Grandma's Notes"},
+				Icon:        "res/drawable-ldpi/icon.png",
+				VersionCode: "7",
+				VersionName: "Grandma's 1.0",
+				SDK:         "9",
+				Permissions: []string{"android.permission.WRITE_EXTERNAL_STORAGE"},
+			},
+		},
+		{
+			name: "label only on the application line",
+			out: "package: name='com.example.widget' versionCode='3' versionName='3'\n" +
+				"uses-permission: name='android.permission.INTERNET' maxSdkVersion='22'\n" +
+				"application: label='Clock Widget' icon='res/mipmap/ic.png'\n",
+			want: BadgingInfo{
+				OK:          true,
+				Label:       "Clock Widget",
+				Labels:      map[string]string{"": "Clock Widget"},
+				Icon:        "res/mipmap/ic.png",
+				VersionCode: "3",
+				VersionName: "3",
+				Permissions: []string{"android.permission.INTERNET"},
+			},
+		},
+		{
+			name: "wrapped label does not eat the next entries",
+			out: "application-label:'Line one\nline two'\n" +
+				"uses-permission: name='android.permission.CAMERA'\n" +
+				"application-label-fr:'Ligne\n" +
+				"sdkVersion:'21'\n",
+			locale: "fr",
+			want: BadgingInfo{
+				OK:          true,
+				Label:       "Ligne",
+				Labels:      map[string]string{"": "Line one line two", "fr": "Ligne"},
+				SDK:         "21",
+				Permissions: []string{"android.permission.CAMERA"},
+			},
+		},
+		{
+			name: "escaped label",
+			out:  `application-label:'\u30ab\u30e1\u30e9 \ud83d\udcf7'` + "\n",
+			want: BadgingInfo{
+				OK:     true,
+				Label:  "カメラ 📷",
+				Labels: map[string]string{"": "カメラ 📷"},
+			},
+		},
+		{
+			name: "empty output",
+			out:  "",
+			want: BadgingInfo{Labels: map[string]string{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseBadging(tt.out, tt.locale); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBadging =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want map[string]string
+	}{
+		{
+			name: "locale variants",
+			out: "package: name='com.android.camera' versionCode='1'\n" +
+				"application-label:'Camera'\n" +
+				"application-label-de:'Kamera'\n" +
+				"application-label-pt-BR:'Câmera'\n" +
+				"application-label-zh-CN:'相机'\n" +
+				"application: label='Camera' icon='res/mipmap/ic.png'\n",
+			want: map[string]string{"": "Camera", "de": "Kamera", "pt-BR": "Câmera", "zh-CN": "相机"},
+		},
+		{
+			name: "apostrophe",
+			out:  "application-label:'Grandma's Recipes'\napplication-label-fr:'L'Équipe'\n",
+			want: map[string]string{"": "Grandma's Recipes", "fr": "L'Équipe"},
+		},
+		{
+			name: "application line fallback with apostrophe",
+			out:  "application: label='Grandma's Recipes' icon='res/mipmap/ic.png'\n",
+			want: map[string]string{"": "Grandma's Recipes"},
+		},
+		{
+			name: "wrapped label",
+			out:  "application-label:'A very long\nlabel'\nsdkVersion:'24'\n",
+			want: map[string]string{"": "A very long label"},
+		},
+		{
+			name: "unclosed quote stops at the next entry",
+			out:  "application-label:'Broken\nsdkVersion:'24'\napplication-label-de:'Kaputt'\n",
+			want: map[string]string{"": "Broken", "de": "Kaputt"},
+		},
+		{
+			name: "unclosed quote stops after maxLabelLines",
+			out:  "application-label:'a\nb\nc\nd\ne\nf\n",
+			want: map[string]string{"": "a b c d"},
+		},
+		{
+			name: "first duplicate wins",
+			out:  "application-label:'One'\napplication-label:'Two'\n",
+			want: map[string]string{"": "One"},
+		},
+		{
+			name: "no labels",
+			out:  "package: name='com.foo'\n",
+			want: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseBadging(tt.out, "").Labels; !maps.Equal(got, tt.want) {
+				t.Errorf("labels = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChooseLabel(t *testing.T) {
+	labels := map[string]string{"": "Camera", "de": "Kamera", "pt-BR": "Câmera", "pt-PT": "Câmara"}
+	tests := []struct{ locale, want string }{
+		{"", "Camera"},
+		{"de", "Kamera"},
+		{"de-AT", "Kamera"},
+		{"pt_BR", "Câmera"},
+		{"pt", "Câmera"},
+		{"fr", "Camera"},
+	}
+	for _, tt := range tests {
+		if got := chooseLabel(labels, tt.locale); got != tt.want {
+			t.Errorf("chooseLabel(%q) = %q, want %q", tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestUnescapeAapt(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Camera", "Camera"},
+		{`\u30ab\u30e1\u30e9`, "カメラ"},
+		{`\u0645\u062a\u062c\u0631`, "متجر"},
+		{`\ud83d\ude80 Launch`, "🚀 Launch"},
+		{`\uD83D\uDE00`, "😀"},
+		// a lone surrogate cannot be encoded
+		{`\ud83d!`, "\uFFFD!"},
+		{`\ud83d\u0041`, "\uFFFDA"},
+		{"カメラ", "カメラ"},
+		{"متجر البرامج", "متجر البرامج"},
+		{"👨‍👩‍👧 Family", "👨‍👩‍👧 Family"},
+		{`\u00e9t\u00e9`, "été"},
+		{`\303\251t\303\251`, "été"},
+		{`It\'s \"new\"`, `It's "new"`},
+		{`C:\\dir`, `C:\dir`},
+		{`one\ntwo\tthree`, "one two three"},
+		{`\u12`, `\u12`},
+		{`\uzzzz`, `\uzzzz`},
+		{`trailing\`, `trailing\`},
+		{"bad \xff byte", "bad \uFFFD byte"},
+		{`\377 octal`, "\uFFFD octal"},
+	}
+	for _, tt := range tests {
+		if got := unescapeAapt(tt.in); got != tt.want {
+			t.Errorf("unescapeAapt(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config holds user settings read from config.json in the config dir.
+// Every field is optional; the zero value is the default behaviour.
+type Config struct {
+	// NotifyOnFailure posts a termux-notification when a launch fails,
+	// for runs started from a widget where stderr is not visible.
+	// Requires Termux:API.
+	NotifyOnFailure bool `json:"notifyOnFailure"`
+
+	// Sort is the default --sort mode.
+	Sort string `json:"sort"`
+	// SortTiebreak orders apps the sort mode considers equal. It takes
+	// any --sort mode name and defaults to label.
+	SortTiebreak string `json:"sortTiebreak"`
+
+	// Folders groups packages under a name. The picker lists folders
+	// before the remaining apps and opens one to pick from its apps.
+	Folders map[string][]string `json:"folders"`
+
+	// Exclude are glob patterns of packages to leave out, merged with
+	// .drawerignore files; "!pattern" re-includes.
+	Exclude []string `json:"exclude"`
+
+	// KeepHomeLauncher lists the default home app, which is left out
+	// otherwise.
+	KeepHomeLauncher bool `json:"keepHomeLauncher"`
+
+	// Tags labels packages, keyed by tag name. Apps tagged "distracting"
+	// are hidden while focus mode is on.
+	Tags map[string][]string `json:"tags"`
+	// FocusDuration is how long --focus=on lasts, as a Go duration such as
+	// "45m". Defaults to an hour.
+	FocusDuration string `json:"focusDuration"`
+
+	// MainOverrides maps a package to the activity to launch instead of
+	// the resolved one. Names may be relative (".Main").
+	MainOverrides map[string]string `json:"mainOverrides"`
+
+	// LabelLocale picks a localized app label from aapt, e.g. "de" or
+	// "pt-BR". By default the app's default label is shown.
+	LabelLocale string `json:"labelLocale"`
+
+	// LaunchSteps is the launch policy: the methods tried in order until
+	// one works ("am", "monkey", "store"). Defaults to am then store.
+	LaunchSteps []string `json:"launchSteps"`
+
+	// AaptPath is the badging tool to run instead of aapt from $PATH. Any
+	// tool printing aapt-compatible badging output works.
+	AaptPath string `json:"aaptPath"`
+	// AaptArgs are the arguments passed before the APK path; they
+	// replace the default "dump badging".
+	AaptArgs []string `json:"aaptArgs"`
+}
+
+// overrideMain applies MainOverrides to a.
+func (c *Config) overrideMain(a *AppInfo) {
+	if m := c.MainOverrides[a.Package]; m != "" {
+		a.Main = qualifyActivity(a.Package, m)
+	}
+}
+
+// configPath returns the config file location, following the XDG base
+// directory spec.
+func configPath() (string, error) {
+	if d := os.Getenv("XDG_CONFIG_HOME"); d != "" {
+		return filepath.Join(d, "drawercli", "config.json"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "drawercli", "config.json"), nil
+}
+
+// loadConfig reads the config file. A missing file is not an error.
+func loadConfig() (*Config, error) {
+	cfg := &Config{}
+	p, err := configPath()
+	if err != nil {
+		return cfg, err
+	}
+	b, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return &Config{}, err
+	}
+	return cfg, nil
+}
+
+// unknownConfigKeys returns the top-level keys of the config file b that
+// are no Config field, sorted. Keys are compared case-insensitively, as
+// encoding/json matches them.
+func unknownConfigKeys(b []byte) ([]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	t := reflect.TypeFor[Config]()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		known[strings.ToLower(name)] = true
+	}
+	var unknown []string
+	for k := range raw {
+		if !known[strings.ToLower(k)] {
+			unknown = append(unknown, k)
+		}
+	}
+	slices.Sort(unknown)
+	return unknown, nil
+}
+
+// checkConfig validates the config file for --check-config and prints a
+// report. Problems that change what the drawer does, such as unknown keys
+// or a bad sort mode, are errors and make it return 1; packages in folders,
+// tags or mainOverrides that are not installed are only warnings, since
+// the same config may be shared between devices.
+func checkConfig(ctx context.Context) int {
+	p, err := configPath()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	b, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		fmt.Printf("%s: no config file, using defaults\n", p)
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var errs, warns []string
+	errorf := func(format string, a ...any) { errs = append(errs, fmt.Sprintf(format, a...)) }
+	warnf := func(format string, a ...any) { warns = append(warns, fmt.Sprintf(format, a...)) }
+
+	cfg := &Config{}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		fmt.Printf("%s: error: %v\n", p, err)
+		return 1
+	}
+	unknown, err := unknownConfigKeys(b)
+	if err != nil {
+		errorf("%v", err)
+	}
+	for _, k := range unknown {
+		errorf("unknown key %q", k)
+	}
+
+	for _, m := range [][2]string{{"sort", cfg.Sort}, {"sortTiebreak", cfg.SortTiebreak}} {
+		if m[1] == "" {
+			continue
+		}
+		if _, err := sortKey(m[1], nil); err != nil {
+			errorf("%s: %v", m[0], err)
+		}
+	}
+	if len(cfg.LaunchSteps) > 0 {
+		if _, err := parseLaunchSteps(strings.Join(cfg.LaunchSteps, ",")); err != nil {
+			errorf("launchSteps: %v", err)
+		}
+	}
+	for _, pat := range cfg.Exclude {
+		if _, err := parseIgnoreRule(pat); err != nil {
+			errorf("exclude: %v", err)
+		}
+	}
+	if cfg.FocusDuration != "" {
+		if d, err := time.ParseDuration(cfg.FocusDuration); err != nil || d <= 0 {
+			errorf("focusDuration: %q is not a positive duration such as 45m", cfg.FocusDuration)
+		}
+	}
+	if cfg.LabelLocale != "" && !validLocale(cfg.LabelLocale) {
+		errorf("labelLocale: %q is not a locale such as de or pt-BR", cfg.LabelLocale)
+	}
+	if cfg.AaptPath != "" {
+		if _, err := exec.LookPath(cfg.AaptPath); err != nil {
+			errorf("aaptPath: %v", err)
+		}
+	}
+
+	installed, err := getPackages(ctx)
+	if err != nil {
+		warnf("cannot list packages, not checking package names: %v", err)
+	} else {
+		have := make(map[string]bool, len(installed))
+		for _, pkg := range installed {
+			have[pkg] = true
+		}
+		for _, pkg := range slices.Sorted(maps.Keys(cfg.MainOverrides)) {
+			if !have[pkg] {
+				warnf("mainOverrides: %s is not installed", pkg)
+			}
+		}
+		for _, group := range []struct {
+			key  string
+			pkgs map[string][]string
+		}{{"folders", cfg.Folders}, {"tags", cfg.Tags}} {
+			for _, name := range slices.Sorted(maps.Keys(group.pkgs)) {
+				for _, pkg := range group.pkgs[name] {
+					if !have[pkg] {
+						warnf("%s: %s: %s is not installed", group.key, name, pkg)
+					}
+				}
+			}
+		}
+	}
+
+	for _, e := range errs {
+		fmt.Printf("%s: error: %s\n", p, e)
+	}
+	for _, w := range warns {
+		fmt.Printf("%s: warning: %s\n", p, w)
+	}
+	if len(errs) > 0 {
+		return 1
+	}
+	fmt.Printf("%s: OK\n", p)
+	return 0
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeConfig installs s as the config file for the rest of the test.
+func writeConfig(t *testing.T, s string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	if err := os.MkdirAll(filepath.Join(dir, "drawercli"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "drawercli", "config.json"), []byte(s), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// installedRunner answers pm list packages with pkgs.
+func installedRunner(pkgs ...string) *fakeRunner {
+	return &fakeRunner{fn: func(ctx context.Context, name string, args []string) (string, string, error) {
+		out := ""
+		for _, p := range pkgs {
+			out += "package:" + p + "\n"
+		}
+		return out, "", nil
+	}}
+}
+
+func TestCheckConfigUninstalledOverride(t *testing.T) {
+	useRunner(t, installedRunner("com.termux"))
+	writeConfig(t, `{"mainOverrides": {"com.termux": ".Main", "com.other.device": ".Main"},
+		"folders": {"Work": ["com.missing"]}}`)
+	if code := checkConfig(context.Background()); code != 0 {
+		t.Errorf("checkConfig = %d, want 0: packages not installed here are warnings", code)
+	}
+}
+
+func TestUnknownConfigKeys(t *testing.T) {
+	got, err := unknownConfigKeys([]byte(`{"sort": "label", "Folders": {}, "sortTieBreak": "icon",
+		"colour": "red", "labelLocal": "de", "aapt": "x"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"aapt", "colour", "labelLocal"}; !slices.Equal(got, want) {
+		t.Errorf("unknownConfigKeys = %q, want %q", got, want)
+	}
+	if _, err := unknownConfigKeys([]byte(`["sort"]`)); err == nil {
+		t.Error("unknownConfigKeys accepted a config that is not an object")
+	}
+}
+
+func TestCheckConfigReportsEveryUnknownKey(t *testing.T) {
+	useRunner(t, installedRunner("com.termux"))
+	writeConfig(t, `{"colour": "red", "sort": "label", "labelLocal": "de"}`)
+	out := captureStdout(t, func() {
+		if code := checkConfig(context.Background()); code != 1 {
+			t.Errorf("checkConfig = %d, want 1", code)
+		}
+	})
+	for _, k := range []string{`unknown key "colour"`, `unknown key "labelLocal"`} {
+		if !strings.Contains(out, k) {
+			t.Errorf("report does not list %s:\n%s", k, out)
+		}
+	}
+}
+
+// captureStdout returns what f prints to stdout.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = old }()
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+	f()
+	w.Close()
+	return <-done
+}
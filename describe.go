@@ -0,0 +1,73 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// notablePermissions are the privacy-relevant permissions --describe
+// calls out by name, with a short description.
+var notablePermissions = []struct{ Name, Desc string }{
+	{"android.permission.INTERNET", "internet"},
+	{"android.permission.CAMERA", "camera"},
+	{"android.permission.RECORD_AUDIO", "microphone"},
+	{"android.permission.ACCESS_FINE_LOCATION", "precise location"},
+	{"android.permission.ACCESS_COARSE_LOCATION", "approximate location"},
+	{"android.permission.ACCESS_BACKGROUND_LOCATION", "background location"},
+	{"android.permission.READ_CONTACTS", "contacts"},
+	{"android.permission.READ_SMS", "SMS"},
+	{"android.permission.READ_CALL_LOG", "call log"},
+	{"android.permission.BODY_SENSORS", "body sensors"},
+	{"android.permission.MANAGE_EXTERNAL_STORAGE", "all files"},
+}
+
+// describe prints details about one package for --describe and the picker
+// preview. arg may be a picker payload ("pkg|main"); folder and other
+// non-app lines print nothing.
+func describe(ctx context.Context, cfg *Config, arg string) int {
+	pkg, _, _ := strings.Cut(arg, "|")
+	if !isPackageName(pkg) {
+		return 0
+	}
+	dctx, cancel := withTimeout(ctx, 8*time.Second)
+	defer cancel()
+
+	info, b, err := probe(dctx, pkg, "")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "probe incomplete:", err)
+	}
+	cfg.overrideMain(info)
+	fmt.Printf("Label:    %s\n", info.Label)
+	fmt.Printf("Package:  %s\n", info.Package)
+	if info.Main == "UNKNOWN_MAIN" {
+		fmt.Println("Activity: (none, opens the store page)")
+	} else {
+		fmt.Printf("Activity: %s\n", info.Main)
+	}
+	if b.VersionName != "" {
+		fmt.Printf("Version:  %s (%s)\n", b.VersionName, b.VersionCode)
+	}
+	if b.SDK != "" {
+		fmt.Printf("SDK:      min %s, target %s\n", b.SDK, cmp.Or(b.TargetSDK, b.SDK))
+	}
+	if !b.OK {
+		return 0
+	}
+	perms := b.Permissions
+	var notable []string
+	for _, p := range notablePermissions {
+		if slices.Contains(perms, p.Name) {
+			notable = append(notable, p.Desc)
+		}
+	}
+	fmt.Printf("Permissions: %d requested\n", len(perms))
+	if len(notable) > 0 {
+		fmt.Printf("  notable: %s\n", strings.Join(notable, ", "))
+	}
+	return 0
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// exportApps writes apps to dir in the given format.
+func exportApps(format, dir string, apps []*AppInfo) error {
+	switch format {
+	case "widget":
+		if dir == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return err
+			}
+			dir = filepath.Join(home, ".shortcuts")
+		}
+		return exportWidget(dir, apps)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// exportWidget writes one Termux:Widget script per launchable app into dir.
+// Termux:Widget shows the file name, so scripts are named after the label;
+// apps whose labels collide get their package name appended.
+func exportWidget(dir string, apps []*AppInfo) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	used := map[string]bool{}
+	n := 0
+	for _, a := range apps {
+		if a.Main == "UNKNOWN_MAIN" {
+			continue
+		}
+		name := safeFileName(a.Label)
+		if name == "" || used[name] {
+			name = safeFileName(a.Label + " (" + a.Package + ")")
+		}
+		used[name] = true
+
+		script := fmt.Sprintf("#!/data/data/com.termux/files/usr/bin/sh\nexec %s --user %s --launch %s\n",
+			shellQuote(self), androidUser, shellQuote(a.Package))
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+			return err
+		}
+		n++
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d widget scripts to %s\n", n, dir)
+	return nil
+}
+
+// safeFileName maps s to a name without path separators or control
+// characters, so it can be used as a single file name.
+func safeFileName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\' || r == ':':
+			return '_'
+		case r < 0x20 || r == 0x7f:
+			return -1
+		}
+		return r
+	}, s)
+	s = strings.TrimSpace(s)
+	s = strings.TrimLeft(s, ".")
+	return s
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
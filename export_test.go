@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportWidgetPassesUser(t *testing.T) {
+	useUser(t, "10")
+	dir := t.TempDir()
+	apps := []*AppInfo{{Package: "com.example.app", Main: ".Main", Label: "Example"}}
+	if err := exportWidget(dir, apps); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "Example"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), " --user 10 --launch 'com.example.app'\n") {
+		t.Errorf("widget script does not pass the user:\n%s", b)
+	}
+}
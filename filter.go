@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dropSystemComponents removes system packages without a launcher
+// activity. With --system these are mostly providers, overlays and other
+// components that cannot be opened and have no store page; third-party
+// apps without a launcher are kept since they fall back to the store.
+func dropSystemComponents(apps []*AppInfo) []*AppInfo {
+	kept := apps[:0]
+	for _, a := range apps {
+		if a.System && a.Main == "UNKNOWN_MAIN" {
+			continue
+		}
+		kept = append(kept, a)
+	}
+	return kept
+}
+
+// launchablePackages keeps the packages of pkgs that have a launcher
+// activity, for --list-packages. No APK is read: packages the launcher map
+// or mainOverrides do not cover are resolved as probePackage does, at most
+// probeLimit at a time, so the result matches the apps the picker can
+// launch.
+func launchablePackages(ctx context.Context, cfg *Config, pkgs []string, launchers map[string]string) []string {
+	ok := make([]bool, len(pkgs))
+	sem := make(chan struct{}, probeLimit())
+	var wg sync.WaitGroup
+	for i, p := range pkgs {
+		main := launchers[p]
+		if main == "" {
+			main = cfg.MainOverrides[p]
+		}
+		if main != "" {
+			ok[i] = true
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, p string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			rctx, cancel := withTimeout(ctx, 4*time.Second)
+			defer cancel()
+			main, _ := resolveMain(rctx, p)
+			ok[i] = main != ""
+		}(i, p)
+	}
+	wg.Wait()
+
+	var kept []string
+	for i, p := range pkgs {
+		if ok[i] {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// homeLauncher returns the package of the default home app. The answer is
+// saved in the state dir and reused when pm cannot tell, e.g. while no
+// default is set and the chooser would be shown.
+func homeLauncher(ctx context.Context) string {
+	rctx, cancel := withTimeout(ctx, 4*time.Second)
+	defer cancel()
+	out, _ := runCmd(rctx, "pm", "resolve-activity", "--user", androidUser,
+		"-a", "android.intent.action.MAIN",
+		"-c", "android.intent.category.HOME")
+	pkg := ""
+	if line := firstLineContaining(out, "packageName="); line != "" {
+		_, pkg, _ = strings.Cut(line, "packageName=")
+		pkg = strings.TrimSpace(pkg)
+	}
+	name := ""
+	if line := firstLineContaining(out, "name="); line != "" {
+		_, name, _ = strings.Cut(line, "name=")
+	}
+	if pkg != "" && isPackageName(pkg) && !isResolverActivity(strings.TrimSpace(name)) {
+		if err := writeState("home_launcher", pkg); err != nil {
+			fmt.Fprintln(os.Stderr, "cannot save home launcher:", err)
+		}
+		return pkg
+	}
+	pkg, _ = readState("home_launcher")
+	return pkg
+}
+
+// dropHomeLauncher removes the default home app, which is pointless to
+// open from the drawer.
+func dropHomeLauncher(ctx context.Context, pkgs []string) []string {
+	home := homeLauncher(ctx)
+	if home == "" {
+		return pkgs
+	}
+	return slices.DeleteFunc(pkgs, func(p string) bool { return p == home })
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLaunchablePackages(t *testing.T) {
+	r := &fakeRunner{fn: func(ctx context.Context, name string, args []string) (string, string, error) {
+		if name == "pm" && args[0] == "resolve-activity" && args[len(args)-1] == "com.resolved" {
+			return "  name=com.resolved.Main\n  packageName=com.resolved\n", "", nil
+		}
+		return "No activity found", "", nil
+	}}
+	useRunner(t, r)
+	cfg := &Config{MainOverrides: map[string]string{"com.override": ".Home"}}
+	pkgs := []string{"com.bulk", "com.resolved", "com.override", "com.none"}
+	launchers := map[string]string{"com.bulk": "com.bulk.Main"}
+
+	got := launchablePackages(context.Background(), cfg, pkgs, launchers)
+	want := []string{"com.bulk", "com.resolved", "com.override"}
+	if !slices.Equal(got, want) {
+		t.Errorf("launchablePackages = %q, want %q", got, want)
+	}
+	// the bulk map and overrides answer without a pm call
+	for _, c := range r.called("pm resolve-activity") {
+		if strings.HasSuffix(c, " com.bulk") || strings.HasSuffix(c, " com.override") {
+			t.Errorf("unneeded %q", c)
+		}
+	}
+}
+
+func TestLaunchablePackagesConcurrent(t *testing.T) {
+	var running, peak atomic.Int32
+	useRunner(t, &fakeRunner{fn: func(ctx context.Context, name string, args []string) (string, string, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(5 * time.Millisecond)
+		pkg := args[len(args)-1]
+		if strings.HasSuffix(pkg, "0") {
+			return "No activity found", "", nil
+		}
+		return "  name=" + pkg + ".Main\n", "", nil
+	}})
+	var pkgs, want []string
+	for i := range 40 {
+		p := fmt.Sprintf("com.app%d", i)
+		pkgs = append(pkgs, p)
+		if i%10 != 0 {
+			want = append(want, p)
+		}
+	}
+	got := launchablePackages(context.Background(), &Config{}, pkgs, nil)
+	if !slices.Equal(got, want) {
+		t.Errorf("launchablePackages = %q, want %q", got, want)
+	}
+	if p := int(peak.Load()); p < 2 || p > probeLimit() {
+		t.Errorf("%d resolves ran at once, want 2 to %d", p, probeLimit())
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// focusTag is the tag of apps hidden while focus mode is on.
+const focusTag = "distracting"
+
+// defaultFocusDuration is used by --focus=on when the config sets none.
+const defaultFocusDuration = time.Hour
+
+// focusUntil returns when the current focus session ends, or the zero
+// time when none is active.
+func focusUntil() (time.Time, error) {
+	s, err := readState("focus_until")
+	if err != nil || s == "" {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad focus_until %q: %w", s, err)
+	}
+	if !time.Now().Before(t) {
+		return time.Time{}, nil
+	}
+	return t, nil
+}
+
+// focusCommand handles --focus: "on" or a duration starts a session,
+// "off" ends it and "status" prints the time left.
+func focusCommand(cfg *Config, arg string) int {
+	switch arg {
+	case "off":
+		if err := writeState("focus_until", ""); err != nil {
+			fmt.Fprintln(os.Stderr, "cannot stop focus mode:", err)
+			return 1
+		}
+		return 0
+	case "status":
+		until, err := focusUntil()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if until.IsZero() {
+			fmt.Println("focus mode is off")
+			return 0
+		}
+		fmt.Printf("focus mode on, %s left (until %s)\n",
+			time.Until(until).Round(time.Minute), until.Format("15:04"))
+		return 0
+	}
+
+	d := cmp.Or(cfg.FocusDuration, defaultFocusDuration.String())
+	if arg != "on" {
+		d = arg
+	}
+	dur, err := time.ParseDuration(d)
+	if err != nil || dur <= 0 {
+		fmt.Fprintf(os.Stderr, "invalid focus duration %q (want on, off, status or e.g. 45m)\n", d)
+		return 2
+	}
+	until := time.Now().Add(dur)
+	if err := writeState("focus_until", until.Format(time.RFC3339)); err != nil {
+		fmt.Fprintln(os.Stderr, "cannot start focus mode:", err)
+		return 1
+	}
+	fmt.Printf("focus mode on until %s\n", until.Format("15:04"))
+	return 0
+}
+
+// dropDistracting removes apps tagged distracting while focus mode is on.
+func dropDistracting(cfg *Config, pkgs []string) []string {
+	hidden := cfg.Tags[focusTag]
+	if len(hidden) == 0 {
+		return pkgs
+	}
+	until, err := focusUntil()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ignoring focus mode:", err)
+		return pkgs
+	}
+	if until.IsZero() {
+		return pkgs
+	}
+	return slices.DeleteFunc(pkgs, func(p string) bool { return slices.Contains(hidden, p) })
+}
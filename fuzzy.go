@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// fuzzyScore scores how well query matches text as a case-insensitive
+// subsequence, as a tiny stand-in for fzf. Each matched character scores
+// one point, two more when it follows the previous match directly and
+// three more at the start of a word; every skipped character between
+// matches costs one. ok is false when query is not a subsequence of text.
+func fuzzyScore(query, text string) (score int, ok bool) {
+	q := []rune(strings.ToLower(query))
+	if len(q) == 0 {
+		return 0, true
+	}
+	t := []rune(strings.ToLower(text))
+	qi, last := 0, -1
+	for ti := 0; ti < len(t) && qi < len(q); ti++ {
+		if t[ti] != q[qi] {
+			continue
+		}
+		score++
+		switch {
+		case last >= 0 && ti == last+1:
+			score += 2
+		case last >= 0:
+			score -= ti - last - 1
+		}
+		if ti == 0 || !unicode.IsLetter(t[ti-1]) && !unicode.IsDigit(t[ti-1]) {
+			score += 3
+		}
+		last = ti
+		qi++
+	}
+	return score, qi == len(q)
+}
+
+// fuzzyFilter returns the apps matching query by label or package, best
+// first; ties keep the list order.
+func fuzzyFilter(apps []*AppInfo, query string) []*AppInfo {
+	type match struct {
+		a     *AppInfo
+		score int
+	}
+	var ms []match
+	for _, a := range apps {
+		sl, okl := fuzzyScore(query, a.Label)
+		sp, okp := fuzzyScore(query, a.Package)
+		if !okl && !okp {
+			continue
+		}
+		if !okl || okp && sp > sl {
+			sl = sp
+		}
+		ms = append(ms, match{a, sl})
+	}
+	sort.SliceStable(ms, func(i, j int) bool { return ms[i].score > ms[j].score })
+	out := make([]*AppInfo, len(ms))
+	for i, m := range ms {
+		out[i] = m.a
+	}
+	return out
+}
+
+// builtinShown is how many matches the built-in picker lists.
+const builtinShown = 10
+
+// pickBuiltin is the picker used when fzf is not installed: it reads a
+// query on the terminal, lists the best matches numbered and reads the
+// number of the app to launch. Anything else is taken as a new query and
+// an empty line quits.
+func pickBuiltin(apps []*AppInfo, opt pickOptions) (selection, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return selection{}, err
+	}
+	defer tty.Close()
+	in := bufio.NewScanner(tty)
+
+	query := opt.Query
+	if query == "" {
+		fmt.Fprint(tty, "search> ")
+		if !in.Scan() {
+			return selection{}, errAborted
+		}
+		query = strings.TrimSpace(in.Text())
+	}
+	for {
+		if query == "" {
+			return selection{}, errAborted
+		}
+		if opt.OnQuery != nil {
+			opt.OnQuery(query)
+		}
+		matches := fuzzyFilter(apps, query)
+		if len(matches) > builtinShown {
+			matches = matches[:builtinShown]
+		}
+		if len(matches) == 0 {
+			fmt.Fprintf(tty, "no apps match %q\n", query)
+		}
+		for i, a := range matches {
+			fmt.Fprintf(tty, "%2d  %s\n", i+1, opt.Display.visible(a))
+		}
+		fmt.Fprint(tty, "number, new search or enter to quit> ")
+		if !in.Scan() {
+			return selection{}, errAborted
+		}
+		answer := strings.TrimSpace(in.Text())
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(matches) {
+			a := matches[n-1]
+			return selection{Pkg: a.Package, Main: a.Main}, nil
+		}
+		query = answer
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		query, text string
+		score       int
+		ok          bool
+	}{
+		{"", "Camera", 0, true},
+		{"cam", "Camera", 10, true},
+		{"CAM", "camera", 10, true},
+		{"cam", "Google Camera", 10, true},
+		{"gc", "Google Camera", 2, true},
+		{"gm", "Gmail", 7, true},
+		{"ab", "a-b", 7, true},
+		{"aa", "baaa", 4, true},
+		{"カメ", "カメラ", 7, true},
+		{"termux", "com.termux", 19, true},
+		{"xyz", "Camera", 0, false},
+		{"camx", "Camera", 10, false},
+		{"cam", "", 0, false},
+	}
+	for _, tt := range tests {
+		score, ok := fuzzyScore(tt.query, tt.text)
+		if ok != tt.ok || ok && score != tt.score {
+			t.Errorf("fuzzyScore(%q, %q) = %d, %v, want %d, %v", tt.query, tt.text, score, ok, tt.score, tt.ok)
+		}
+	}
+}
+
+func TestFuzzyScoreRanks(t *testing.T) {
+	// a prefix beats a word start, which beats matches scattered
+	// through the word
+	prefix, _ := fuzzyScore("map", "Maps")
+	word, _ := fuzzyScore("map", "Google Maps")
+	scattered, _ := fuzzyScore("map", "Mega App")
+	if !(prefix >= word && word > scattered) {
+		t.Errorf("scores prefix %d, word %d, scattered %d", prefix, word, scattered)
+	}
+}
+
+func TestFuzzyFilter(t *testing.T) {
+	apps := []*AppInfo{
+		{Label: "Calculator", Package: "com.android.calculator2"},
+		{Label: "Camera", Package: "com.android.camera"},
+		{Label: "Google Camera", Package: "com.google.android.GoogleCamera"},
+		{Label: "Settings", Package: "com.termux"},
+		{Label: "Cam Scanner", Package: "com.intsig.camscanner"},
+	}
+	var got []string
+	for _, a := range fuzzyFilter(apps, "cam") {
+		got = append(got, a.Label)
+	}
+	want := []string{"Camera", "Google Camera", "Cam Scanner"}
+	if !slices.Equal(got, want) {
+		t.Errorf("fuzzyFilter(cam) = %q, want %q", got, want)
+	}
+	if got := fuzzyFilter(apps, "termux"); len(got) != 1 || got[0].Label != "Settings" {
+		t.Errorf("fuzzyFilter(termux) = %v, want the package match", got)
+	}
+	if got := fuzzyFilter(apps, "zzz"); len(got) != 0 {
+		t.Errorf("fuzzyFilter(zzz) = %v", got)
+	}
+}
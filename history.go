@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// historyEntry records how often and how recently a package was launched.
+type historyEntry struct {
+	Count int       `json:"count"`
+	Last  time.Time `json:"last"`
+	// Hours counts launches per hour of the day (local time), for
+	// --sort=smart.
+	Hours [24]int `json:"hours"`
+}
+
+// history is the launch history kept in the state dir, keyed by package.
+type history map[string]*historyEntry
+
+func (h history) count(pkg string) int {
+	if e := h[pkg]; e != nil {
+		return e.Count
+	}
+	return 0
+}
+
+func (h history) last(pkg string) time.Time {
+	if e := h[pkg]; e != nil {
+		return e.Last
+	}
+	return time.Time{}
+}
+
+// hourScore rates how typical a launch of pkg is at hour: launches in
+// that hour count most, those in the neighbouring hours less.
+func (h history) hourScore(pkg string, hour int) int {
+	e := h[pkg]
+	if e == nil {
+		return 0
+	}
+	return 3*e.Hours[hour] + e.Hours[(hour+23)%24] + e.Hours[(hour+1)%24]
+}
+
+// resetHours forgets the learned time-of-day data, keeping launch counts.
+func resetHours() error {
+	h, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	for _, e := range h {
+		e.Hours = [24]int{}
+	}
+	return saveHistory(h)
+}
+
+func loadHistory() (history, error) {
+	h := history{}
+	s, err := readState("history.json")
+	if err != nil || s == "" {
+		return h, err
+	}
+	if err := json.Unmarshal([]byte(s), &h); err != nil {
+		return history{}, err
+	}
+	return h, nil
+}
+
+func saveHistory(h history) error {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return writeState("history.json", string(b))
+}
+
+// recordLaunch adds a launch of pkg to the stored history.
+func recordLaunch(pkg string) error {
+	h, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	e := h[pkg]
+	if e == nil {
+		e = &historyEntry{}
+		h[pkg] = e
+	}
+	now := time.Now()
+	e.Count++
+	e.Last = now
+	e.Hours[now.Hour()]++
+	return saveHistory(h)
+}
+
+// probeOrder reorders pkgs so that packages likely to be launchable are
+// probed first: frequently launched ones, then ones a bulk strategy found
+// a launcher for. Without hints the original order is kept. It is used
+// under --aapt-budget, where the first packages probed get the labels.
+func probeOrder(pkgs []string, launchers map[string]string, h history) []string {
+	score := func(pkg string) int {
+		n := 0
+		if e := h[pkg]; e != nil {
+			n += e.Count + 1
+		}
+		if launchers[pkg] != "" {
+			n++
+		}
+		return n
+	}
+	ordered := append([]string(nil), pkgs...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return score(ordered[i]) > score(ordered[j])
+	})
+	return ordered
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestProbeOrder(t *testing.T) {
+	pkgs := []string{"com.lib", "com.found", "com.rare", "com.often", "com.other"}
+	launchers := map[string]string{"com.found": ".Main", "com.often": ".Main"}
+	h := history{
+		"com.rare":  {Count: 1},
+		"com.often": {Count: 9},
+	}
+	got := probeOrder(pkgs, launchers, h)
+	want := []string{"com.often", "com.rare", "com.found", "com.lib", "com.other"}
+	if !slices.Equal(got, want) {
+		t.Errorf("probeOrder = %q, want %q", got, want)
+	}
+	if pkgs[0] != "com.lib" {
+		t.Error("probeOrder reordered its input")
+	}
+	if got := probeOrder(pkgs, nil, nil); !slices.Equal(got, pkgs) {
+		t.Errorf("without hints probeOrder = %q, want the original order", got)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ignoreFile is the name of the per-directory exclude list.
+const ignoreFile = ".drawerignore"
+
+// ignoreRule is one exclude pattern; Negate re-includes what earlier rules
+// excluded.
+type ignoreRule struct {
+	Pattern string
+	Negate  bool
+}
+
+// parseIgnoreRule reads a pattern line, "!" marking a negation. Patterns
+// are path.Match globs over the package name, e.g. "com.google.*".
+func parseIgnoreRule(l string) (ignoreRule, error) {
+	r := ignoreRule{Pattern: l}
+	if p, ok := strings.CutPrefix(l, "!"); ok {
+		r = ignoreRule{Pattern: p, Negate: true}
+	}
+	if _, err := path.Match(r.Pattern, ""); err != nil {
+		return ignoreRule{}, fmt.Errorf("bad pattern %q: %w", l, err)
+	}
+	return r, nil
+}
+
+// readIgnoreFile parses a .drawerignore file: one pattern per line, blank
+// lines and lines starting with '#' skipped. A missing file has no rules.
+func readIgnoreFile(name string) ([]ignoreRule, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		l := strings.TrimFunc(sc.Text(), isJunk)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		r, err := parseIgnoreRule(l)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, sc.Err()
+}
+
+// ignoreRules collects the exclude rules in precedence order: the exclude
+// config key, then ~/.drawerignore, then .drawerignore in the working
+// directory. As in .gitignore the last matching rule decides, so the more
+// local file can re-include what a broader one hides.
+func ignoreRules(cfg *Config) ([]ignoreRule, error) {
+	var rules []ignoreRule
+	for _, p := range cfg.Exclude {
+		r, err := parseIgnoreRule(p)
+		if err != nil {
+			return nil, fmt.Errorf("exclude: %w", err)
+		}
+		rules = append(rules, r)
+	}
+	var files []string
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ignoreFile))
+	}
+	if wd, err := os.Getwd(); err == nil {
+		f := filepath.Join(wd, ignoreFile)
+		if !slices.Contains(files, f) {
+			files = append(files, f)
+		}
+	}
+	for _, f := range files {
+		r, err := readIgnoreFile(f)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r...)
+	}
+	return rules, nil
+}
+
+// ignored reports whether the last rule matching pkg excludes it.
+func ignored(rules []ignoreRule, pkg string) bool {
+	ign := false
+	for _, r := range rules {
+		if ok, _ := path.Match(r.Pattern, pkg); ok {
+			ign = !r.Negate
+		}
+	}
+	return ign
+}
+
+// dropIgnored removes the packages excluded by rules.
+func dropIgnored(rules []ignoreRule, pkgs []string) []string {
+	if len(rules) == 0 {
+		return pkgs
+	}
+	return slices.DeleteFunc(pkgs, func(p string) bool { return ignored(rules, p) })
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIgnoredNegation(t *testing.T) {
+	rules := func(ps ...string) []ignoreRule {
+		var rs []ignoreRule
+		for _, p := range ps {
+			r, err := parseIgnoreRule(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs = append(rs, r)
+		}
+		return rs
+	}
+	tests := []struct {
+		rules []string
+		pkg   string
+		want  bool
+	}{
+		{nil, "com.google.maps", false},
+		{[]string{"com.google.*"}, "com.google.maps", true},
+		{[]string{"com.google.*"}, "com.googlex", false},
+		{[]string{"com.google.*", "!com.google.maps"}, "com.google.maps", false},
+		{[]string{"com.google.*", "!com.google.maps"}, "com.google.gm", true},
+		// the last match wins, so a later exclude overrides the negation
+		{[]string{"com.google.*", "!com.google.maps", "com.google.maps"}, "com.google.maps", true},
+		{[]string{"!com.google.maps", "com.google.*"}, "com.google.maps", true},
+		// a negation with nothing to re-include does nothing
+		{[]string{"!com.foo"}, "com.foo", false},
+		{[]string{"*.*.bloat*"}, "com.oem.bloatware", true},
+		{[]string{"com.?oo"}, "com.foo", true},
+		{[]string{"com.[fb]oo"}, "com.boo", true},
+	}
+	for _, tt := range tests {
+		if got := ignored(rules(tt.rules...), tt.pkg); got != tt.want {
+			t.Errorf("ignored(%q, %s) = %v, want %v", tt.rules, tt.pkg, got, tt.want)
+		}
+	}
+	if _, err := parseIgnoreRule("com.[foo"); err == nil {
+		t.Error("parseIgnoreRule accepted a bad pattern")
+	}
+}
+
+func TestIgnoreRulesPrecedence(t *testing.T) {
+	home, wd := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	t.Chdir(wd)
+	write := func(dir, s string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, ignoreFile), []byte(s), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// config hides all of Google, home re-includes maps and hides the
+	// OEM apps, the working directory re-includes one OEM app
+	cfg := &Config{Exclude: []string{"com.google.*"}}
+	write(home, "# personal\n!com.google.maps\n\ncom.oem.*\r\n")
+	write(wd, "!com.oem.camera\n")
+
+	rules, err := ignoreRules(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgs := []string{"com.google.maps", "com.google.gm", "com.oem.camera", "com.oem.store", "com.termux"}
+	got := dropIgnored(rules, pkgs)
+	want := []string{"com.google.maps", "com.oem.camera", "com.termux"}
+	if !slices.Equal(got, want) {
+		t.Errorf("dropIgnored = %q, want %q", got, want)
+	}
+
+	write(wd, "com.[oem\n")
+	if _, err := ignoreRules(cfg); err == nil || !strings.Contains(err.Error(), ":1: bad pattern") {
+		t.Errorf("err = %v, want the file and line of the bad pattern", err)
+	}
+}
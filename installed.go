@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dumpsysTime is the timestamp format of `dumpsys package`.
+const dumpsysTime = "2006-01-02 15:04:05"
+
+// installTimes reads every package's firstInstallTime for androidUser with
+// a single `dumpsys package packages` call.
+func installTimes(ctx context.Context) (map[string]time.Time, error) {
+	dctx, cancel := withTimeout(ctx, 15*time.Second)
+	defer cancel()
+	out, err := runCmd(dctx, "dumpsys", "package", "packages")
+	if err != nil {
+		return nil, err
+	}
+	return parseInstallTimes(out, androidUser), nil
+}
+
+// parseInstallTimes extracts firstInstallTime from a package dump:
+//
+//	Package [com.foo] (5c3a5b2):
+//	  firstInstallTime=2024-03-01 12:00:00
+//	  User 0: ceDataInode=1234 installed=true ...
+//	    firstInstallTime=2024-03-01 12:00:00
+//
+// Newer releases repeat the time per user; that one wins over the package
+// wide value when it is for user.
+func parseInstallTimes(out, user string) map[string]time.Time {
+	times := map[string]time.Time{}
+	var pkg, inUser string
+	sc := bufio.NewScanner(strings.NewReader(out))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		l := strings.TrimFunc(sc.Text(), isJunk)
+		switch {
+		case strings.HasPrefix(l, "Package ["):
+			pkg, _, _ = strings.Cut(strings.TrimPrefix(l, "Package ["), "]")
+			inUser = ""
+		case strings.HasPrefix(l, "User ") && pkg != "":
+			inUser, _, _ = strings.Cut(strings.TrimPrefix(l, "User "), ":")
+		case strings.HasPrefix(l, "firstInstallTime=") && pkg != "":
+			if inUser != "" && inUser != user {
+				continue
+			}
+			t, err := time.ParseInLocation(dumpsysTime, strings.TrimPrefix(l, "firstInstallTime="), time.Local)
+			if err != nil {
+				continue
+			}
+			times[pkg] = t
+		}
+	}
+	return times
+}
+
+// defaultRecentLimit is how many apps --mode=recently-installed shows
+// unless --limit says otherwise.
+const defaultRecentLimit = 10
+
+// recentlyInstalled returns the limit most recently installed of pkgs,
+// newest first. Packages without a known install time are left out.
+func recentlyInstalled(pkgs []string, times map[string]time.Time, limit int) []string {
+	var recent []string
+	for _, p := range pkgs {
+		if _, ok := times[p]; ok {
+			recent = append(recent, p)
+		}
+	}
+	sortByInstallTime(recent, func(p string) string { return p }, times)
+	if len(recent) > limit {
+		recent = recent[:limit]
+	}
+	return recent
+}
+
+// sortByInstallTime orders s newest install first, ties by package name.
+func sortByInstallTime[T any](s []T, pkg func(T) string, times map[string]time.Time) {
+	sort.SliceStable(s, func(i, j int) bool {
+		pi, pj := pkg(s[i]), pkg(s[j])
+		if c := times[pj].Compare(times[pi]); c != 0 {
+			return c < 0
+		}
+		return pi < pj
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// labelEntry is a label read from an APK, kept with what identifies the
+// APK so an update or a changed labelLocale config key reads it again.
+type labelEntry struct {
+	APK     string    `json:"apk"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Locale  string    `json:"locale"`
+	Label   string    `json:"label"`
+	Icon    string    `json:"icon,omitempty"`
+}
+
+// labelStore caches labels across runs under --aapt-budget, so apps that
+// did not fit in one run's budget are read on a later one and keep their
+// label from then on. A nil *labelStore caches nothing.
+type labelStore struct {
+	mu      sync.Mutex
+	entries map[string]labelEntry
+	dirty   bool
+}
+
+// labelCache is the cache probe uses, nil unless --aapt-budget is set.
+var labelCache *labelStore
+
+func loadLabelCache() (*labelStore, error) {
+	c := &labelStore{entries: map[string]labelEntry{}}
+	s, err := readState("labels.json")
+	if err != nil || s == "" {
+		return c, err
+	}
+	if err := json.Unmarshal([]byte(s), &c.entries); err != nil {
+		return &labelStore{entries: map[string]labelEntry{}}, err
+	}
+	return c, nil
+}
+
+// lookup returns the cached label of pkg if apk is unchanged since it was
+// read with locale.
+func (c *labelStore) lookup(pkg, apk, locale string) (labelEntry, bool) {
+	if c == nil || apk == "" {
+		return labelEntry{}, false
+	}
+	c.mu.Lock()
+	e, ok := c.entries[pkg]
+	c.mu.Unlock()
+	if !ok || e.APK != apk || e.Locale != locale {
+		return labelEntry{}, false
+	}
+	fi, err := os.Stat(apk)
+	if err != nil || fi.Size() != e.Size || !fi.ModTime().Equal(e.ModTime) {
+		return labelEntry{}, false
+	}
+	return e, true
+}
+
+// store remembers the label read from apk for pkg.
+func (c *labelStore) store(pkg, apk, locale string, b BadgingInfo) {
+	if c == nil || b.Label == "" {
+		return
+	}
+	fi, err := os.Stat(apk)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[pkg] = labelEntry{APK: apk, Size: fi.Size(), ModTime: fi.ModTime(),
+		Locale: locale, Label: b.Label, Icon: b.Icon}
+	c.dirty = true
+}
+
+// save writes the cache back if anything changed. An entry is dropped
+// only once its APK is gone, from an uninstall or an update moving it, so
+// a run that lists just some of the apps keeps the others' labels.
+func (c *labelStore) save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for pkg, e := range c.entries {
+		if _, err := os.Stat(e.APK); err != nil {
+			delete(c.entries, pkg)
+			c.dirty = true
+		}
+	}
+	if !c.dirty {
+		return nil
+	}
+	b, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	return writeState("labels.json", string(b))
+}
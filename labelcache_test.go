@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// apkRunner serves pm path and aapt for fake APKs under dir, with each
+// package labelled "Label <pkg>".
+func apkRunner(dir string) *fakeRunner {
+	return &fakeRunner{fn: func(ctx context.Context, name string, args []string) (string, string, error) {
+		switch {
+		case name == "pm" && args[0] == "path":
+			return "package:" + filepath.Join(dir, args[1], "base.apk") + "\n", "", nil
+		case name == "aapt":
+			pkg := filepath.Base(filepath.Dir(args[len(args)-1]))
+			return "application-label:'Label " + pkg + "'\n", "", nil
+		}
+		return "", "", errors.New("exit status 1")
+	}}
+}
+
+func TestLabelCacheSpreadsBudget(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+	pkgs := []string{"com.a", "com.b", "com.c"}
+	for _, p := range pkgs {
+		if err := os.MkdirAll(filepath.Join(dir, p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, p, "base.apk"), []byte(p), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := apkRunner(dir)
+	useRunner(t, r)
+	oldBudget, oldCache := aaptBudget, labelCache
+	t.Cleanup(func() {
+		aaptBudget, labelCache = oldBudget, oldCache
+		aaptCalls.Store(0)
+		probeFailures.Store(0)
+	})
+	aaptBudget = 2
+
+	labelled := func(pkgs ...string) int {
+		t.Helper()
+		aaptCalls.Store(0)
+		var err error
+		if labelCache, err = loadLabelCache(); err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, a := range probeAll(context.Background(), pkgs, 1, nil) {
+			if a.Label == "Label "+a.Package {
+				n++
+			}
+		}
+		if err := labelCache.save(); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if n := labelled(pkgs...); n != 2 {
+		t.Fatalf("first run labelled %d apps, want the budget of 2", n)
+	}
+	if n := labelled(pkgs...); n != 3 {
+		t.Fatalf("second run labelled %d apps, want all 3 with the cache", n)
+	}
+	if n := len(r.called("aapt")); n != 3 {
+		t.Errorf("aapt ran %d times over both runs, want once per app", n)
+	}
+
+	// an updated APK is read again
+	if err := os.WriteFile(filepath.Join(dir, "com.a", "base.apk"), []byte("com.a v2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	labelled(pkgs...)
+	if got := r.called("aapt"); len(got) != 4 || !strings.Contains(got[3], "com.a") {
+		t.Errorf("after updating com.a aapt ran %q", got)
+	}
+
+	// a filtered run, e.g. --mode=recently-installed, keeps the labels
+	// of the apps it does not list
+	labelled("com.b")
+	c, err := loadLabelCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.entries) != 3 {
+		t.Errorf("after a run listing com.b the cache has %d entries, want 3", len(c.entries))
+	}
+
+	// an uninstalled app's label is dropped
+	if err := os.RemoveAll(filepath.Join(dir, "com.c")); err != nil {
+		t.Fatal(err)
+	}
+	labelled("com.a")
+	if c, _ = loadLabelCache(); len(c.entries) != 2 || c.entries["com.c"].Label != "" {
+		t.Errorf("after removing com.c the cache holds %v", c.entries)
+	}
+}
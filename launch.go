@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// settingsScreen is one entry of the per-app settings sub-menu.
+type settingsScreen struct {
+	Name string
+	Args func(pkg string) []string
+}
+
+var settingsScreens = []settingsScreen{
+	{"App info", func(pkg string) []string {
+		return []string{"-a", "android.settings.APPLICATION_DETAILS_SETTINGS", "-d", "package:" + pkg}
+	}},
+	{"Notifications", func(pkg string) []string {
+		return []string{"-a", "android.settings.APP_NOTIFICATION_SETTINGS",
+			"--es", "android.provider.extra.APP_PACKAGE", pkg,
+			"--es", "app_package", pkg}
+	}},
+	{"Permissions", func(pkg string) []string {
+		return []string{"-a", "android.intent.action.MANAGE_APP_PERMISSIONS",
+			"--es", "android.intent.extra.PACKAGE_NAME", pkg}
+	}},
+	{"Storage access", func(pkg string) []string {
+		return []string{"-a", "android.settings.MANAGE_APP_ALL_FILES_ACCESS_PERMISSION", "-d", "package:" + pkg}
+	}},
+	{"Open by default", func(pkg string) []string {
+		return []string{"-a", "android.settings.APP_OPEN_BY_DEFAULT_SETTINGS", "-d", "package:" + pkg}
+	}},
+}
+
+// launchOptions tweak how launchApp starts an app.
+type launchOptions struct {
+	// Resume brings the app's existing task to the front, as a home
+	// screen does, instead of starting the activity on top of it.
+	Resume bool
+	// Steps are the launch methods to try, in order; see launchSteps.
+	Steps []string
+	// Display is the id of the display to open the app on; "" is the
+	// default display.
+	Display string
+	// Locale switches the app to this per-app locale before launching,
+	// for testing translations; see applyLaunchLocale.
+	Locale string
+}
+
+// FLAG_ACTIVITY_NEW_TASK | FLAG_ACTIVITY_RESET_TASK_IF_NEEDED, the flags a
+// launcher uses so an existing task is resumed rather than restarted.
+const resumeFlags = "0x10200000"
+
+// errSkipped marks a launch step that does not apply to the app.
+var errSkipped = errors.New("not applicable")
+
+// launchSteps are the launch methods a launch policy can be built from.
+var launchSteps = map[string]func(ctx context.Context, pkg, main string, opt launchOptions) error{
+	"am":     launchActivity,
+	"monkey": launchMonkey,
+	"store":  openStorePage,
+}
+
+// defaultLaunchSteps starts the known activity and opens the store page
+// when there is none or it cannot be started.
+var defaultLaunchSteps = []string{"am", "store"}
+
+// parseLaunchSteps validates a comma separated step list.
+func parseLaunchSteps(s string) ([]string, error) {
+	var steps []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if launchSteps[name] == nil {
+			return nil, fmt.Errorf("unknown launch step %q (want am, monkey or store)", name)
+		}
+		steps = append(steps, name)
+	}
+	if len(steps) == 0 {
+		return nil, errors.New("no launch steps given")
+	}
+	return steps, nil
+}
+
+// launchApp tries each launch step in turn until one succeeds. Steps that
+// do not apply (am without a known activity) are skipped silently; when a
+// step fails the next one is tried and the one that worked is reported.
+func launchApp(ctx context.Context, pkg, main string, opt launchOptions) error {
+	steps := opt.Steps
+	if len(steps) == 0 {
+		steps = defaultLaunchSteps
+	}
+	if opt.Locale != "" && ctx.Err() == nil {
+		applyLaunchLocale(ctx, pkg, opt.Locale)
+	}
+	var errs []error
+	for _, name := range steps {
+		// fail fast rather than let am or the next step run against a
+		// context that is already done
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("launch cancelled: %w", err)
+		}
+		err := launchSteps[name](ctx, pkg, main, opt)
+		if errors.Is(err, errSkipped) {
+			continue
+		}
+		if err == nil {
+			if len(errs) > 0 {
+				fmt.Fprintf(os.Stderr, "%s: launched via %s\n", pkg, name)
+			}
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s failed: %v\n", pkg, name, err)
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("no launch step applies (tried %s)", strings.Join(steps, ", "))
+	}
+	return errors.Join(errs...)
+}
+
+// launchActivity starts the launcher activity main with am.
+func launchActivity(ctx context.Context, pkg, main string, opt launchOptions) error {
+	if main == "UNKNOWN_MAIN" {
+		return errSkipped
+	}
+	err := startComponent(ctx, pkg+"/"+main, opt)
+	if err == nil {
+		return nil
+	}
+	// resolve may have picked an internal activity while the real launcher
+	// target is an activity-alias; try the other declared launcher entries
+	for _, alt := range queryActivities(ctx, pkg) {
+		if alt == main {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v; trying %s\n", main, err, alt)
+		if startComponent(ctx, pkg+"/"+alt, opt) == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// launchMonkey asks monkey to send one launcher event to pkg, which lets
+// the system pick the activity.
+func launchMonkey(ctx context.Context, pkg, main string, opt launchOptions) error {
+	out, err := runCmd(ctx, "monkey", "-p", pkg, "-c", "android.intent.category.LAUNCHER", "1")
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, out)
+	}
+	if line := firstLineContaining(out, "No activities found"); line != "" {
+		return errors.New(line)
+	}
+	if strings.Contains(out, "monkey aborted") {
+		return errors.New("monkey aborted")
+	}
+	return nil
+}
+
+// openStorePage opens the Play Store page of pkg.
+func openStorePage(ctx context.Context, pkg, main string, opt launchOptions) error {
+	playstoreURL := "https://play.google.com/store/apps/details?id=" + pkg
+	if out, err := runCmd(ctx, "termux-open-url", playstoreURL); err != nil {
+		return fmt.Errorf("opening store page: %w: %s", err, out)
+	}
+	return nil
+}
+
+// startComponent starts a "pkg/activity" component with am.
+func startComponent(ctx context.Context, component string, opt launchOptions) error {
+	if opt.Resume {
+		// with no existing task this starts the app fresh
+		err := amStartOn(ctx, opt.Display, "-a", "android.intent.action.MAIN",
+			"-c", "android.intent.category.LAUNCHER",
+			"-f", resumeFlags, "-n", component)
+		if err == nil {
+			return nil
+		}
+		fmt.Fprintln(os.Stderr, "resume failed, starting fresh:", err)
+	}
+	return amStartOn(ctx, opt.Display, "-n", component)
+}
+
+// amStartOn runs amStart on the given display. When am is too old to know
+// --display the app is started on the default display instead.
+func amStartOn(ctx context.Context, display string, args ...string) error {
+	if display == "" {
+		return amStart(ctx, args...)
+	}
+	err := amStart(ctx, append([]string{"--display", display}, args...)...)
+	if err != nil && strings.Contains(err.Error(), "nknown option") {
+		fmt.Fprintln(os.Stderr, "am does not support --display here, using the default display")
+		return amStart(ctx, args...)
+	}
+	return err
+}
+
+// launchCommand returns the shell command that launches pkg the way
+// launchApp does, for pasting into scripts.
+func launchCommand(pkg, main string) string {
+	if main == "UNKNOWN_MAIN" {
+		return "termux-open-url https://play.google.com/store/apps/details?id=" + pkg
+	}
+	return fmt.Sprintf("am start --user %s -n %s/%s", androidUser, pkg, shellQuote(main))
+}
+
+// intentURI returns an intent: URI starting pkg's launcher activity, as
+// `am start <URI>` and Intent.parseUri accept it. Apps without a known
+// activity get their store page URL instead.
+func intentURI(pkg, main string) string {
+	if main == "UNKNOWN_MAIN" {
+		return "https://play.google.com/store/apps/details?id=" + pkg
+	}
+	return "intent:#Intent;action=android.intent.action.MAIN;" +
+		"category=android.intent.category.LAUNCHER;" +
+		"component=" + uriEncode(pkg+"/"+main) + ";end"
+}
+
+// uriEncode escapes s like Android's Uri.encode(s, "/"), which is how
+// Intent.toUri writes the component.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("_-!.~'()*/", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// copyToClipboard puts text on the Android clipboard. Requires Termux:API.
+func copyToClipboard(ctx context.Context, text string) error {
+	if out, err := runCmd(ctx, "termux-clipboard-set", text); err != nil {
+		return fmt.Errorf("termux-clipboard-set (is Termux:API installed?): %v %s", err, out)
+	}
+	return nil
+}
+
+// launchPackage probes a single package and launches it, for --launch.
+func launchPackage(ctx context.Context, cfg *Config, pkg string, opt launchOptions) int {
+	pctx, cancel := withTimeout(ctx, 4*time.Second)
+	info, err := probePackage(pctx, pkg, "")
+	cancel()
+	if err != nil {
+		probeFailures.Add(1)
+		// the launch steps work without a label, and still fall back to
+		// the store page when the activity is unknown
+		fmt.Fprintln(os.Stderr, "probe incomplete:", err)
+	}
+	cfg.overrideMain(info)
+	if err := launchApp(ctx, info.Package, info.Main, opt); err != nil {
+		return reportLaunchFailure(cfg, pkg, err)
+	}
+	if err := recordLaunch(pkg); err != nil {
+		fmt.Fprintln(os.Stderr, "cannot save launch history:", err)
+	}
+	return 0
+}
+
+// exitCancelled is the exit status for a run stopped by a signal, as a
+// shell reports SIGINT.
+const exitCancelled = 130
+
+// reportLaunchFailure prints err and, if configured, posts a Termux
+// notification so failures from widget launches are not lost. It returns
+// the exit status to use.
+func reportLaunchFailure(cfg *Config, pkg string, err error) int {
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "launch of %s cancelled\n", pkg)
+		return exitCancelled
+	}
+	fmt.Fprintln(os.Stderr, "launch failed:", err)
+	if !cfg.NotifyOnFailure {
+		return 1
+	}
+	// the launch context may be what failed, so use a fresh one
+	ctx, cancel := withTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+	out, nerr := runCmd(ctx, "termux-notification",
+		"--id", "drawercli-launch",
+		"--title", "drawercli: cannot launch "+pkg,
+		"--content", err.Error())
+	if nerr != nil {
+		fmt.Fprintf(os.Stderr, "termux-notification failed (is Termux:API installed?): %v %s\n", nerr, out)
+	}
+	return 1
+}
+
+// amStart runs `am start` with args. am frequently exits 0 even when the
+// intent could not be resolved, so its output is checked for an error line.
+func amStart(ctx context.Context, args ...string) error {
+	amArgs := append([]string{"start", "--user", androidUser}, args...)
+	out, err := runCmd(ctx, "am", amArgs...)
+	if err != nil {
+		if out != "" {
+			return fmt.Errorf("%w: %s", err, out)
+		}
+		return err
+	}
+	if line := amError(out); line != "" {
+		return errors.New(line)
+	}
+	return nil
+}
+
+// amError returns the first error line of am start output, such as
+//
+//	Error: Activity class {com.foo/com.foo.Main} does not exist.
+//	Error type 3
+//
+// Only lines starting that way count: am echoes the intent it starts, and
+// "Starting: Intent { cmp=com.foo/.ErrorActivity }" is a success.
+func amError(out string) string {
+	for _, l := range strings.Split(out, "\n") {
+		l = strings.TrimFunc(l, isJunk)
+		if strings.HasPrefix(l, "Error:") || strings.HasPrefix(l, "Error type") {
+			return l
+		}
+	}
+	return ""
+}
+
+// openSettings shows the settings sub-menu for pkg and opens the chosen
+// screen. Screens the ROM does not provide fall back to the app info page.
+func openSettings(ctx context.Context, pkg string) int {
+	var input strings.Builder
+	for _, s := range settingsScreens {
+		input.WriteString(s.Name + "\n")
+	}
+	fzfCmd := exec.Command("fzf", "--layout=reverse", "--prompt=settings> ", "--header="+pkg)
+	fzfCmd.Stdin = strings.NewReader(input.String())
+	fzfCmd.Stderr = os.Stderr
+	chosen, err := fzfCmd.Output()
+	if err != nil {
+		return 1
+	}
+	name := strings.TrimSpace(string(chosen))
+
+	for i, s := range settingsScreens {
+		if s.Name != name {
+			continue
+		}
+		err := amStart(ctx, s.Args(pkg)...)
+		if err == nil {
+			return 0
+		}
+		if i == 0 {
+			fmt.Fprintln(os.Stderr, "cannot open app info:", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "%s screen not supported on this device, opening App info\n", s.Name)
+		if err := amStart(ctx, settingsScreens[0].Args(pkg)...); err != nil {
+			fmt.Fprintln(os.Stderr, "cannot open app info:", err)
+			return 1
+		}
+		return 0
+	}
+	return 1
+}
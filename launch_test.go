@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// amRunner starts only the components in ok; am start of anything else
+// prints an error the way am does, with exit status 0. query-activities
+// lists acts.
+func amRunner(ok map[string]bool, acts ...string) *fakeRunner {
+	return &fakeRunner{fn: func(ctx context.Context, name string, args []string) (string, string, error) {
+		switch {
+		case name == "am" && args[0] == "start":
+			c := args[len(args)-1]
+			if ok[c] {
+				return "Starting: Intent { cmp=" + c + " }", "", nil
+			}
+			return "Starting: Intent { cmp=" + c + " }\nError: Activity class {" + c + "} does not exist.", "", nil
+		case name == "cmd" && args[1] == "query-activities":
+			var b strings.Builder
+			for i, a := range acts {
+				fmt.Fprintf(&b, "Activity #%d:\n  priority=0 preferredOrder=0\n  %s\n", i, a)
+			}
+			return b.String(), "", nil
+		}
+		return "", "", fmt.Errorf("unexpected %s %q", name, args)
+	}}
+}
+
+// started returns the components r ran am start on, in order.
+func started(r *fakeRunner) []string {
+	var cs []string
+	for _, c := range r.called("am start") {
+		cs = append(cs, c[strings.LastIndex(c, " ")+1:])
+	}
+	return cs
+}
+
+func TestAmError(t *testing.T) {
+	tests := []struct{ out, want string }{
+		{"Starting: Intent { cmp=com.foo/.Main }", ""},
+		{"Starting: Intent { cmp=com.foo/.ErrorReportActivity }", ""},
+		{"Starting: Intent { cmp=com.foo/.Main }\nError: Activity class {com.foo/com.foo.Main} does not exist.",
+			"Error: Activity class {com.foo/com.foo.Main} does not exist."},
+		{"Starting: Intent { cmp=com.foo/.Main }\r\nError type 3\r\nError: Activity not started",
+			"Error type 3"},
+		{"Warning: Activity not started, its current task has been brought to the front", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := amError(tt.out); got != tt.want {
+			t.Errorf("amError(%q) = %q, want %q", tt.out, got, tt.want)
+		}
+	}
+}
+
+func TestLaunchActivityAliasFallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		ok      []string
+		acts    []string
+		wantErr bool
+		want    []string
+	}{
+		{
+			name: "main starts",
+			ok:   []string{"com.foo/com.foo.Main"},
+			acts: []string{"com.foo/.Alias"},
+			want: []string{"com.foo/com.foo.Main"},
+		},
+		{
+			name: "alias after main fails",
+			ok:   []string{"com.foo/com.foo.Alias"},
+			acts: []string{"com.foo/.Main", "com.foo/.Alias"},
+			want: []string{"com.foo/com.foo.Main", "com.foo/com.foo.Alias"},
+		},
+		{
+			name: "second alias",
+			ok:   []string{"com.foo/com.foo.Second"},
+			acts: []string{"com.foo/.First", "com.foo/.Second", "com.foo/.Third"},
+			want: []string{"com.foo/com.foo.Main", "com.foo/com.foo.First", "com.foo/com.foo.Second"},
+		},
+		{
+			name:    "every alias fails",
+			acts:    []string{"com.foo/.Main", "com.foo/.Alias"},
+			wantErr: true,
+			want:    []string{"com.foo/com.foo.Main", "com.foo/com.foo.Alias"},
+		},
+		{
+			name:    "no other launcher",
+			wantErr: true,
+			want:    []string{"com.foo/com.foo.Main"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok := map[string]bool{}
+			for _, c := range tt.ok {
+				ok[c] = true
+			}
+			r := amRunner(ok, tt.acts...)
+			useRunner(t, r)
+			err := launchActivity(context.Background(), "com.foo", "com.foo.Main", launchOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr && err != nil && !strings.Contains(err.Error(), "com.foo.Main} does not exist") {
+				t.Errorf("err = %v, want the error for the resolved activity", err)
+			}
+			if got := started(r); !slices.Equal(got, tt.want) {
+				t.Errorf("started %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLaunchActivityUnknownMain(t *testing.T) {
+	r := amRunner(nil)
+	useRunner(t, r)
+	if err := launchActivity(context.Background(), "com.foo", "UNKNOWN_MAIN", launchOptions{}); !errors.Is(err, errSkipped) {
+		t.Errorf("err = %v, want errSkipped", err)
+	}
+	if len(r.calls) != 0 {
+		t.Errorf("ran %q", r.calls)
+	}
+}
+
+// stepRunner answers the commands of every launch step; the programs in
+// fail exit 1.
+func stepRunner(fail ...string) *fakeRunner {
+	return &fakeRunner{fn: func(ctx context.Context, name string, args []string) (string, string, error) {
+		if slices.Contains(fail, name) {
+			return name + ": broken", "", errors.New("exit status 1")
+		}
+		switch name {
+		case "am":
+			return "Starting: Intent { cmp=" + args[len(args)-1] + " }", "", nil
+		case "monkey":
+			return "Events injected: 1", "", nil
+		case "termux-open-url", "cmd":
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("unexpected %s %q", name, args)
+	}}
+}
+
+func TestLaunchAppSteps(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   []string
+		main    string
+		fail    []string
+		wantErr string
+		want    []string // programs run, in order
+	}{
+		{name: "am", main: ".Main", want: []string{"am"}},
+		{name: "store when am fails", main: ".Main", fail: []string{"am"},
+			want: []string{"am", "cmd", "termux-open-url"}},
+		{name: "store without activity", main: "UNKNOWN_MAIN", want: []string{"termux-open-url"}},
+		{name: "monkey after am", steps: []string{"am", "monkey", "store"}, main: ".Main", fail: []string{"am"},
+			want: []string{"am", "cmd", "monkey"}},
+		{name: "store after monkey", steps: []string{"monkey", "store"}, main: ".Main", fail: []string{"monkey"},
+			want: []string{"monkey", "termux-open-url"}},
+		{name: "every step fails", steps: []string{"am", "monkey", "store"}, main: ".Main",
+			fail: []string{"am", "monkey", "termux-open-url"}, wantErr: "am: exit status 1",
+			want: []string{"am", "cmd", "monkey", "termux-open-url"}},
+		{name: "nothing applies", steps: []string{"am"}, main: "UNKNOWN_MAIN", wantErr: "no launch step applies (tried am)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := stepRunner(tt.fail...)
+			useRunner(t, r)
+			err := launchApp(context.Background(), "com.foo", tt.main, launchOptions{Steps: tt.steps})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("err = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+			var ran []string
+			for _, c := range r.calls {
+				ran = append(ran, strings.Fields(c)[0])
+			}
+			if !slices.Equal(ran, tt.want) {
+				t.Errorf("ran %q, want %q", ran, tt.want)
+			}
+		})
+	}
+}
+
+func TestLaunchCancelled(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := stepRunner()
+	useRunner(t, r)
+	err := launchApp(ctx, "com.foo", ".Main", launchOptions{Locale: "de", Steps: []string{"am", "store"}})
+	if !errors.Is(err, context.Canceled) || !strings.HasPrefix(err.Error(), "launch cancelled") {
+		t.Errorf("err = %v, want launch cancelled", err)
+	}
+	if len(r.calls) != 0 {
+		t.Errorf("ran %q against a cancelled context", r.calls)
+	}
+	if code := reportLaunchFailure(&Config{NotifyOnFailure: true}, "com.foo", err); code != exitCancelled {
+		t.Errorf("reportLaunchFailure = %d, want %d", code, exitCancelled)
+	}
+	if len(r.calls) != 0 {
+		t.Errorf("ran %q for a cancelled launch", r.calls)
+	}
+
+	t.Cleanup(func() { probeFailures.Store(0) })
+	if code := launchPackage(ctx, &Config{}, "com.foo", launchOptions{}); code != exitCancelled {
+		t.Errorf("launchPackage = %d, want %d", code, exitCancelled)
+	}
+	if got := r.called("am"); len(got) != 0 {
+		t.Errorf("launchPackage ran %q", got)
+	}
+	if h, _ := loadHistory(); h.count("com.foo") != 0 {
+		t.Error("a cancelled launch was recorded")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// validLocale reports whether s looks like a locale list for cmd locale,
+// such as "de" or "pt-BR,en-US".
+func validLocale(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-' || r == ',') {
+			return false
+		}
+	}
+	return true
+}
+
+// appLocales returns the per-app locales of pkg, e.g. "de-DE", or "" when
+// it follows the system locale. Needs Android 13's cmd locale.
+func appLocales(ctx context.Context, pkg string) (string, error) {
+	out, err := runCmd(ctx, "cmd", "locale", "get-app-locales", pkg, "--user", androidUser)
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, out)
+	}
+	// "Locales for com.foo for user 0 are [de-DE]"
+	start, end := strings.LastIndex(out, "["), strings.LastIndex(out, "]")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("unexpected cmd locale output: %s", out)
+	}
+	return out[start+1 : end], nil
+}
+
+func setAppLocales(ctx context.Context, pkg, locales string) error {
+	out, err := runCmd(ctx, "cmd", "locale", "set-app-locales", pkg, "--user", androidUser, "--locales", locales)
+	if err == nil && strings.Contains(out, "nknown") {
+		err = fmt.Errorf("%s", out)
+	}
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	return nil
+}
+
+// loadSavedLocales returns the locales apps had before --launch-locale
+// changed them, keyed by package.
+func loadSavedLocales() (map[string]string, error) {
+	saved := map[string]string{}
+	s, err := readState("app_locales.json")
+	if err != nil || s == "" {
+		return saved, err
+	}
+	return saved, json.Unmarshal([]byte(s), &saved)
+}
+
+func saveSavedLocales(saved map[string]string) error {
+	b, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return writeState("app_locales.json", string(b))
+}
+
+// applyLaunchLocale switches pkg to locale before it is launched, keeping
+// its previous setting for --restore-locales. Only the first change of an
+// app is saved so repeated launches still restore the original. Errors
+// are warnings: the app is then launched in its current locale.
+func applyLaunchLocale(ctx context.Context, pkg, locale string) {
+	prev, err := appLocales(ctx, pkg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "per-app locales need Android 13+, launching in the current locale:", err)
+		return
+	}
+	saved, err := loadSavedLocales()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ignoring saved locales:", err)
+	}
+	if _, ok := saved[pkg]; !ok {
+		saved[pkg] = prev
+		if err := saveSavedLocales(saved); err != nil {
+			fmt.Fprintln(os.Stderr, "cannot save previous locale, it will not be restored:", err)
+		}
+	}
+	if err := setAppLocales(ctx, pkg, locale); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot set %s locale to %s, launching in the current locale: %v\n", pkg, locale, err)
+	}
+}
+
+// restoreLocales puts back the locales saved by --launch-locale, for
+// --restore-locales.
+func restoreLocales(ctx context.Context) int {
+	saved, err := loadSavedLocales()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot read saved locales:", err)
+		return 1
+	}
+	pkgs := make([]string, 0, len(saved))
+	for p := range saved {
+		pkgs = append(pkgs, p)
+	}
+	sort.Strings(pkgs)
+	code := 0
+	for _, p := range pkgs {
+		prev := saved[p]
+		if err := setAppLocales(ctx, p, prev); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot restore locale of %s: %v\n", p, err)
+			code = 1
+			continue
+		}
+		delete(saved, p)
+		fmt.Printf("%s: restored %s\n", p, cmp.Or(prev, "system locale"))
+	}
+	if err := saveSavedLocales(saved); err != nil {
+		fmt.Fprintln(os.Stderr, "cannot update saved locales:", err)
+		return 1
+	}
+	return code
+}
@@ -2,61 +2,193 @@ package main
 
 import (
 	"bufio"
-	"bytes"
+	"cmp"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
-	"sort"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode"
 )
 
 type AppInfo struct {
 	Label   string
 	Package string
 	Main    string
+	System  bool
+	// Size is the total size in bytes of the app's APKs, 0 if unknown.
+	Size int64
+	// Icon is the icon resource inside the APK, "" when the app has none
+	// or it was not read.
+	Icon string
 }
 
+var (
+	// androidUser is the Android user (profile) id passed to pm, cmd and
+	// am, set from --user. State files are namespaced by it.
+	androidUser = "0"
+	// verifyMains checks each resolved activity against query-activities
+	// during probing, set from --verify-activities.
+	verifyMains bool
+	// verbose prints diagnostics such as aapt warnings, set from
+	// --verbose.
+	verbose bool
+	// labelLocale selects which localized aapt label is shown, from the
+	// labelLocale config key. Empty uses the default label.
+	labelLocale string
+	// aaptPath and aaptArgs make up the badging command, run with the APK
+	// path appended. Set from the aaptPath and aaptArgs config keys.
+	aaptPath = "aapt"
+	aaptArgs = []string{"dump", "badging"}
+	// aaptBudget caps the badging calls of a run, set from --aapt-budget;
+	// 0 is no limit. aaptCalls counts the calls asked for so far.
+	aaptBudget int
+	aaptCalls  atomic.Int64
+)
+
+// cmdTrace, when set, receives every command runCmd executes together with
+// its raw stdout/stderr. Used by --debug-probe.
+var cmdTrace io.Writer
+
 func runCmd(ctx context.Context, name string, args ...string) (string, error) {
-	cmd := exec.CommandContext(ctx, name, args...)
-	var out bytes.Buffer
-	var errb bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &errb
-	err := cmd.Run()
+	stdout, stderr, err := runCmdSplit(ctx, name, args...)
+	if err != nil {
+		return strings.TrimSpace(stdout + "\n" + stderr), err
+	}
+	return strings.TrimSpace(stdout), nil
+}
+
+// runCmdSplit runs a command like runCmd but returns stdout and stderr
+// untrimmed and apart, for callers that look at warnings on success.
+func runCmdSplit(ctx context.Context, name string, args ...string) (stdout, stderr string, err error) {
+	start := time.Now()
+	stdout, stderr, err = runner.Run(ctx, name, args...)
 	if err != nil {
-		return strings.TrimSpace(out.String() + "\n" + errb.String()), err
+		err = contextError(ctx, name, start, err)
 	}
-	return strings.TrimSpace(out.String()), nil
+	if cmdTrace != nil {
+		traceCmd(cmdTrace, name, args, stdout, stderr, err)
+	}
+	return stdout, stderr, err
 }
 
-func getPackages(ctx context.Context) ([]string, error) {
-	out, err := runCmd(ctx, "pm", "list", "packages", "--user", "0", "-3")
+func traceCmd(w io.Writer, name string, args []string, stdout, stderr string, err error) {
+	fmt.Fprintf(w, "$ %s %s\n", name, strings.Join(args, " "))
+	fmt.Fprintf(w, "--- stdout ---\n%s", stdout)
+	if !strings.HasSuffix(stdout, "\n") {
+		fmt.Fprintln(w)
+	}
+	if stderr != "" {
+		fmt.Fprintf(w, "--- stderr ---\n%s", stderr)
+		if !strings.HasSuffix(stderr, "\n") {
+			fmt.Fprintln(w)
+		}
+	}
 	if err != nil {
-		// continue with whatever returned
+		fmt.Fprintf(w, "--- error: %v\n", err)
 	}
+	fmt.Fprintln(w)
+}
+
+// getPackages lists installed packages; flags are passed on to
+// `pm list packages` (e.g. -3 for third-party only, -s for system only).
+// When pm fails but still printed packages those are used; the error is
+// only returned when none were found.
+func getPackages(ctx context.Context, flags ...string) ([]string, error) {
+	args := append([]string{"list", "packages", "--user", androidUser}, flags...)
+	out, err := runCmd(ctx, "pm", args...)
+	pkgs := parsePackageList(out)
+	if len(pkgs) == 0 && err != nil {
+		if out != "" {
+			return nil, fmt.Errorf("pm list packages: %w: %s", err, out)
+		}
+		return nil, fmt.Errorf("pm list packages: %w", err)
+	}
+	return pkgs, nil
+}
+
+// parsePackageList extracts the package names from `pm list packages`
+// output, skipping duplicates and lines that are not packages.
+func parsePackageList(out string) []string {
 	if out == "" {
-		return nil, nil
+		return nil
 	}
 	lines := strings.Split(out, "\n")
 	var pkgs []string
+	seen := map[string]bool{}
 	for _, l := range lines {
-		l = strings.TrimSpace(l)
-		l = strings.TrimPrefix(l, "package:")
-		if l != "" {
-			pkgs = append(pkgs, l)
+		l = strings.TrimFunc(l, isJunk)
+		if rest, ok := strings.CutPrefix(l, "package:"); ok {
+			l = packageToken(strings.TrimFunc(rest, isJunk))
+		} else if strings.ContainsFunc(l, unicode.IsSpace) {
+			// only "package:" lines carry annotations; this is a
+			// message such as "Failure calling service package: ..."
+			continue
 		}
+		// skip warnings and other noise pm may interleave
+		if !isPackageName(l) || seen[l] {
+			continue
+		}
+		seen[l] = true
+		pkgs = append(pkgs, l)
 	}
-	return pkgs, nil
+	return pkgs
+}
+
+// trimPrefixed strips surrounding whitespace (including \r, NULs and a
+// BOM) and an optional prefix such as "package:" from a line of pm output.
+func trimPrefixed(l, prefix string) string {
+	l = strings.TrimFunc(l, isJunk)
+	l = strings.TrimPrefix(l, prefix)
+	return strings.TrimFunc(l, isJunk)
+}
+
+// packageToken drops annotations some ROMs append after the package name
+// in `pm list packages`, such as "com.foo  uid:10123" or "com.foo\tinstaller=…".
+func packageToken(l string) string {
+	if i := strings.IndexFunc(l, unicode.IsSpace); i >= 0 {
+		return l[:i]
+	}
+	return l
+}
+
+func isJunk(r rune) bool {
+	return unicode.IsSpace(r) || r == 0 || r == '\uFEFF'
 }
 
+// isPackageName reports whether s looks like an Android package name.
+func isPackageName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && (r >= '0' && r <= '9' || r == '_' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// firstLineContaining returns the first line of s containing substr, with
+// surrounding whitespace and carriage returns removed.
 func firstLineContaining(s, substr string) string {
 	sc := bufio.NewScanner(strings.NewReader(s))
 	for sc.Scan() {
-		l := sc.Text()
+		l := strings.TrimFunc(sc.Text(), isJunk)
 		if strings.Contains(l, substr) {
 			return l
 		}
@@ -64,15 +196,31 @@ func firstLineContaining(s, substr string) string {
 	return ""
 }
 
-func probePackage(ctx context.Context, pkg string) (*AppInfo, error) {
-	// get main activity
+// displayLabel makes a label safe to place before the tab-delimited
+// payload: control characters (tabs, newlines) become spaces.
+func displayLabel(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+	return strings.TrimSpace(s)
+}
+
+// resolveMain asks pm for the launcher activity of a single package. The
+// error is pm's; a package without a launcher activity is not an error.
+func resolveMain(ctx context.Context, pkg string) (string, error) {
 	resolveArgs := []string{
-		"resolve-activity", "--user", "0",
+		"resolve-activity", "--user", androidUser,
 		"-a", "android.intent.action.MAIN",
 		"-c", "android.intent.category.LAUNCHER",
 		pkg,
 	}
-	resOut, _ := runCmd(ctx, "pm", resolveArgs...)
+	resOut, err := runCmd(ctx, "pm", resolveArgs...)
+	if err != nil {
+		return "", fmt.Errorf("resolving activity: %w", err)
+	}
 	line := firstLineContaining(resOut, "name=")
 	main := ""
 	if line != "" {
@@ -81,40 +229,139 @@ func probePackage(ctx context.Context, pkg string) (*AppInfo, error) {
 			main = strings.TrimSpace(line[idx+len("name="):])
 		}
 	}
+	if isResolverActivity(main) {
+		// several activities matched and pm answered with the chooser;
+		// ask for the matching activities themselves instead
+		main = queryMain(ctx, pkg)
+	}
+	return main, nil
+}
+
+// badging runs the configured badging command on apk. With --verbose the
+// warnings aapt prints while still succeeding, such as about unknown
+// chunks, are shown for pkg since they often explain an odd label.
+func badging(ctx context.Context, pkg, apk string) (string, error) {
+	out, warn, err := runCmdSplit(ctx, aaptPath, append(slices.Clip(aaptArgs), apk)...)
+	if err != nil {
+		return strings.TrimSpace(out + "\n" + warn), err
+	}
+	if verbose {
+		for _, l := range strings.Split(strings.TrimSpace(warn), "\n") {
+			if l = strings.TrimFunc(l, isJunk); l != "" {
+				fmt.Fprintf(os.Stderr, "%s: %s: %s\n", pkg, aaptPath, l)
+			}
+		}
+	}
+	return strings.TrimSpace(out), nil
+}
 
-	// get apk path
-	pathOut, _ := runCmd(ctx, "pm", "path", pkg, "--user", "0")
-	apkPath := ""
+// takeAaptCall reports whether another badging call fits in aaptBudget.
+func takeAaptCall() bool {
+	return aaptBudget <= 0 || aaptCalls.Add(1) <= int64(aaptBudget)
+}
+
+// checkAapt warns when the badging command cannot be found. Probing still
+// works without it, but every label falls back to the package name.
+func checkAapt() {
+	if _, err := exec.LookPath(aaptPath); err != nil {
+		fmt.Fprintf(os.Stderr, "%s not found, labels will show package names: %v\n", aaptPath, err)
+	}
+}
+
+// apkPaths returns the paths of every APK pkg is installed from: the base
+// APK and any split APKs, in pm's order.
+func apkPaths(ctx context.Context, pkg string) ([]string, error) {
+	pathOut, err := runCmd(ctx, "pm", "path", pkg, "--user", androidUser)
+	if err != nil {
+		return nil, fmt.Errorf("pm path: %w", err)
+	}
+	var paths []string
 	for _, pl := range strings.Split(pathOut, "\n") {
-		pl = strings.TrimSpace(pl)
-		pl = strings.TrimPrefix(pl, "package:")
-		if pl != "" {
-			apkPath = pl
-			break
-		}
-	}
-
-	label := ""
-	if apkPath != "" {
-		aaptOut, err := runCmd(ctx, "aapt", "dump", "badging", apkPath)
-		if err == nil && aaptOut != "" {
-			sc := bufio.NewScanner(strings.NewReader(aaptOut))
-			for sc.Scan() {
-				l := sc.Text()
-				if strings.Contains(l, "application-label:") {
-					start := strings.Index(l, "application-label:")
-					if start >= 0 {
-						l = l[start+len("application-label:"):]
-						l = strings.Trim(l, "'")
-						label = l
-						break
-					}
-				}
+		if pl = trimPrefixed(pl, "package:"); pl != "" {
+			paths = append(paths, pl)
+		}
+	}
+	return paths, nil
+}
+
+// baseAPK picks the base APK out of paths, or "".
+func baseAPK(paths []string) string {
+	for _, p := range paths {
+		if strings.HasSuffix(p, "/base.apk") {
+			return p
+		}
+	}
+	if len(paths) > 0 {
+		return paths[0]
+	}
+	return ""
+}
+
+// apkSize sums the sizes of paths, so apps split into a base and config
+// APKs are not underreported. APKs that cannot be read are skipped.
+func apkSize(paths []string) int64 {
+	var n int64
+	for _, p := range paths {
+		if fi, err := os.Stat(p); err == nil {
+			n += fi.Size()
+		}
+	}
+	return n
+}
+
+// probePackage collects the AppInfo for pkg. main is the launcher activity
+// if a bulk strategy already found it; when empty it is resolved here.
+// When a command fails or times out the error is returned together with
+// an AppInfo filled in from what did work, so the app is still listed.
+func probePackage(ctx context.Context, pkg, main string) (*AppInfo, error) {
+	info, _, err := probe(ctx, pkg, main)
+	return info, err
+}
+
+// probe is probePackage that also returns everything read from the
+// badging output, for --describe. The BadgingInfo is zero when aapt was
+// not run or failed.
+func probe(ctx context.Context, pkg, main string) (*AppInfo, BadgingInfo, error) {
+	var errs []error
+	if main == "" {
+		var err error
+		if main, err = resolveMain(ctx, pkg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	main = qualifyActivity(pkg, main)
+	if verifyMains && main != "" {
+		if acts := queryActivities(ctx, pkg); len(acts) > 0 && !slices.Contains(acts, main) {
+			main = acts[0]
+		}
+	}
+
+	paths, err := apkPaths(ctx, pkg)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	apkPath := baseAPK(paths)
+
+	var b BadgingInfo
+	if e, ok := labelCache.lookup(pkg, apkPath, labelLocale); ok {
+		// only the label and icon are cached; --describe runs without it
+		b.Label, b.Icon = e.Label, e.Icon
+	} else if apkPath != "" && takeAaptCall() {
+		aaptOut, err := badging(ctx, pkg, apkPath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reading label: %w", err))
+			if verbose {
+				// e.g. "aapt timed out after 4s" for a huge APK
+				fmt.Fprintf(os.Stderr, "%s: no label: %v\n", pkg, err)
 			}
+		} else if aaptOut != "" {
+			b = parseBadging(aaptOut, labelLocale)
+			labelCache.store(pkg, apkPath, labelLocale, b)
 		}
 	}
 
 	// fallback label
+	label := b.Label
 	if label == "" {
 		label = pkg
 	}
@@ -127,112 +374,563 @@ func probePackage(ctx context.Context, pkg string) (*AppInfo, error) {
 		Label:   label,
 		Package: pkg,
 		Main:    main,
-	}, nil
+		Size:    apkSize(paths),
+		Icon:    b.Icon,
+	}, b, errors.Join(errs...)
+}
+
+// probeLimit is how many packages are probed concurrently.
+func probeLimit() int {
+	n := runtime.NumCPU()
+	if n < 4 {
+		n = 4
+	}
+	if n > 16 {
+		n = 16
+	}
+	return n
+}
+
+// probeFailures counts the packages whose probe had a failing or timed out
+// command, for --metrics.
+var probeFailures atomic.Int64
+
+// probeAll probes every package, running at most limit probes at a time.
+// launchers holds activities already known from a bulk strategy and may be
+// nil. Packages whose probe partly failed are still listed with what was
+// found and counted in probeFailures.
+func probeAll(ctx context.Context, pkgs []string, limit int, launchers map[string]string) []*AppInfo {
+	sem := make(chan struct{}, limit)
+	results := make([]*AppInfo, len(pkgs))
+	var wg sync.WaitGroup
+	for i, pkg := range pkgs {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, pkg string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			pctx, cancel := withTimeout(ctx, 4*time.Second)
+			defer cancel()
+			info, err := probePackage(pctx, pkg, launchers[pkg])
+			if err != nil {
+				probeFailures.Add(1)
+			}
+			results[i] = info
+		}(i, pkg)
+	}
+	wg.Wait()
+
+	apps := make([]*AppInfo, 0, len(results))
+	for _, a := range results {
+		if a != nil {
+			apps = append(apps, a)
+		}
+	}
+	return apps
+}
+
+// debugProbe runs every probe command for pkg, printing the raw outputs and
+// the parsed AppInfo. Nothing is launched.
+func debugProbe(ctx context.Context, pkg string) int {
+	cmdTrace = os.Stdout
+	defer func() { cmdTrace = nil }()
+
+	pctx, cancel := withTimeout(ctx, 4*time.Second)
+	defer cancel()
+	info, err := probePackage(pctx, pkg, "")
+	if err != nil {
+		fmt.Println("=== probe errors ===")
+		fmt.Println(err)
+	}
+	fmt.Println("=== parsed AppInfo ===")
+	fmt.Printf("Label:   %q\n", info.Label)
+	fmt.Printf("Package: %s\n", info.Package)
+	fmt.Printf("Main:    %s\n", info.Main)
+	return 0
 }
 
 func main() {
-	ctx := context.Background()
+	debugPkg := flag.String("debug-probe", "", "print raw probe output and parsed info for `package`, then exit")
+	resolvePkg := flag.String("resolve", "", "print the `package`'s launch component (pkg/activity) and exit")
+	nth := flag.Int("nth", 0, "launch the `n`th app of the sorted, filtered list without the picker (1 is the first)")
+	launchPkg := flag.String("launch", "", "launch `package` directly without the picker")
+	export := flag.String("export", "", "write the app list in `format` (widget) to the directory given as argument")
+	strategy := flag.String("strategy", "query", "how launcher activities are found: query or dumpsys (one call for all apps), resolve (per package)")
+	list := flag.Bool("list", false, "print the app list instead of opening the picker (picker lines when piped, a table on a terminal)")
+	listPackages := flag.Bool("list-packages", false, "print only the names of launchable packages, one per line, without probing labels (for shell completion)")
+	jsonOut := flag.Bool("json", false, "print the app list as JSON instead of opening the picker")
+	withSystem := flag.Bool("system", false, "include system apps")
+	keepHome := flag.Bool("keep-home", false, "list the default home launcher, which is hidden otherwise")
+	systemComponents := flag.Bool("system-components", false, "with --system, keep system packages that have no launcher activity")
+	flag.IntVar(&aaptBudget, "aapt-budget", 0, "read labels with at most `n` aapt calls; other apps show package names (0: no limit)")
+	recalibrate := flag.Bool("recalibrate", false, "measure the best probe concurrency again instead of reusing the saved one")
+	record := flag.String("record", "", "save every command run and its output to `dir`")
+	replay := flag.String("replay", "", "serve command output from recordings in `dir` instead of running commands")
+	flag.BoolVar(&verbose, "verbose", false, "print diagnostics such as aapt warnings for each package")
+	flag.BoolVar(&verifyMains, "verify-activities", false, "check resolved activities against query-activities (slower)")
+	user := flag.String("user", "0", "Android user `id` to list and launch apps for (e.g. a work profile)")
+	sortMode := flag.String("sort", "", "sort `mode`: label, package, frequent, recent, smart, usage, labellen or icon (default label)")
+	tiebreak := flag.String("sort-tiebreak", "", "`mode` ordering apps the sort mode ties on; takes any --sort mode (default label)")
+	unlaunchLast := flag.Bool("unlaunchable-last", false, "list apps without a launcher activity after all others, whatever the sort mode")
+	metrics := flag.Bool("metrics", false, "append run counters to metrics.prom in the state dir")
+	steps := flag.String("launch-steps", "", "comma separated launch `methods` tried in order: am, monkey, store (default am,store)")
+	displayID := flag.String("display", "", "open apps on display `id` (external monitor, DeX/desktop mode)")
+	launchLocale := flag.String("launch-locale", "", "switch the app to per-app `locale` (e.g. de, pt-BR) before launching it (Android 13+)")
+	restoreLoc := flag.Bool("restore-locales", false, "put back the locales apps had before --launch-locale changed them and exit")
+	resume := flag.Bool("resume", false, "bring the app's existing task to the front instead of restarting its activity")
+	focus := flag.String("focus", "", "hide apps tagged distracting: on, a `duration` (45m), off, or status to show the time left")
+	resetSmart := flag.Bool("reset-smart", false, "forget the time-of-day data used by --sort=smart and exit")
+	copyCmd := flag.Bool("copy", false, "copy the selected app's launch command to the clipboard instead of launching it")
+	printURI := flag.Bool("intent-uri", false, "print the selected app as an intent: URI instead of launching it")
+	show := flag.String("show", "", "extra `columns` after the label, comma separated: package, activity, size")
+	twoColumn := flag.Bool("two-column", false, "show the package next to the label, aligned in a second column")
+	maxLabel := flag.Int("max-label", 0, "truncate displayed labels to `n` characters (0: no limit)")
+	sep := flag.String("sep", "  ", "separator between the label and extra columns")
+	mode := flag.String("mode", "", "`view` to show instead of all apps: recently-installed")
+	limit := flag.Int("limit", 0, fmt.Sprintf("with --mode=recently-installed, show the last `n` installed apps (default %d)", defaultRecentLimit))
+	handles := flag.String("handles", "", "only list apps that can view or receive a share of `mime` type (e.g. application/pdf)")
+	selectPkg := flag.String("select", "", "open the picker with the cursor on `package`")
+	missing := flag.String("missing", "", "print packages listed in template `file` that are not installed and exit")
+	describePkg := flag.String("describe", "", "print details of `package` (activity, permissions) and exit; used by --preview")
+	preview := flag.Bool("preview", false, "show --describe details of the app under the cursor in the picker")
+	initialQuery := flag.String("query", "", "start fzf with `query`; positional arguments do the same")
+	restoreQuery := flag.Bool("restore-query", false, "start fzf with the query from the previous run")
+	checkCfg := flag.Bool("check-config", false, "validate the config file, print a report and exit")
+	toggleSystem := flag.Bool("toggle-system", false, "print the picker's top level with --system switched from its last state; used by the picker's reload key")
+	flag.Parse()
+
+	// cancelled on SIGINT/SIGTERM so running commands are killed and a
+	// pending launch is abandoned
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stats := &runMetrics{Start: time.Now()}
+	// exit writes --metrics before leaving. Runs stopped by bad flags or
+	// a missing terminal are not recorded; --launch and every run from
+	// listing packages on are, failed ones included.
+	exit := func(code int) {
+		if *metrics {
+			if err := stats.append(); err != nil {
+				fmt.Fprintln(os.Stderr, "cannot write metrics:", err)
+			}
+		}
+		os.Exit(code)
+	}
+
+	if _, err := strconv.ParseUint(*user, 10, 32); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --user %q: must be a numeric user id\n", *user)
+		os.Exit(2)
+	}
+	androidUser = *user
+
+	switch {
+	case *record != "" && *replay != "":
+		fmt.Fprintln(os.Stderr, "--record and --replay cannot be combined")
+		os.Exit(2)
+	case *record != "":
+		if err := os.MkdirAll(*record, 0o755); err != nil {
+			fmt.Fprintln(os.Stderr, "cannot create record dir:", err)
+			os.Exit(1)
+		}
+		runner = &recordRunner{next: runner, dir: *record}
+	case *replay != "":
+		runner = replayRunner{dir: *replay}
+	}
+
+	switch *strategy {
+	case "query", "dumpsys", "resolve":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown --strategy %q\n", *strategy)
+		os.Exit(2)
+	}
 
-	pkgs, err := getPackages(ctx)
+	if *checkCfg {
+		os.Exit(checkConfig(ctx))
+	}
+
+	cfg, err := loadConfig()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "error listing packages:", err)
+		fmt.Fprintln(os.Stderr, "ignoring config:", err)
 	}
-	if len(pkgs) == 0 {
-		fmt.Fprintln(os.Stderr, "no packages found")
-		os.Exit(1)
+
+	labelLocale = cfg.LabelLocale
+	if cfg.AaptPath != "" {
+		aaptPath = cfg.AaptPath
+	}
+	if cfg.AaptArgs != nil {
+		aaptArgs = cfg.AaptArgs
+	}
+	// only the paths that read labels warn about a missing aapt
+	warnAapt := func() {
+		if *replay == "" {
+			checkAapt()
+		}
 	}
 
-	numWorkers := runtime.NumCPU()
-	if numWorkers < 4 {
-		numWorkers = 4
+	if *sortMode == "" {
+		*sortMode = cmp.Or(cfg.Sort, "label")
+	}
+	if *tiebreak == "" {
+		*tiebreak = cmp.Or(cfg.SortTiebreak, "label")
 	}
-	if numWorkers > 16 {
-		numWorkers = 16
+	for _, k := range []string{*sortMode, *tiebreak} {
+		if _, err := sortKey(k, nil); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
 	}
 
-	in := make(chan string, len(pkgs))
-	out := make(chan *AppInfo, len(pkgs))
-	var wg sync.WaitGroup
+	switch *mode {
+	case "", "recently-installed":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown --mode %q (want recently-installed)\n", *mode)
+		os.Exit(2)
+	}
+	if *nth < 0 {
+		fmt.Fprintln(os.Stderr, "--nth must be 1 or more")
+		os.Exit(2)
+	}
+	if aaptBudget < 0 {
+		fmt.Fprintln(os.Stderr, "--aapt-budget must not be negative")
+		os.Exit(2)
+	}
+	if *limit < 0 {
+		fmt.Fprintln(os.Stderr, "--limit must not be negative")
+		os.Exit(2)
+	}
 
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for pkg := range in {
-				pctx, cancel := context.WithTimeout(ctx, 4*time.Second)
-				info, err := probePackage(pctx, pkg)
-				cancel()
-				if err == nil && info != nil {
-					out <- info
-				}
-			}
-		}()
+	display, err := parseDisplay(*sep, *show, *maxLabel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *displayID != "" {
+		if _, err := strconv.ParseUint(*displayID, 10, 32); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --display %q: must be a numeric display id\n", *displayID)
+			os.Exit(2)
+		}
+	}
+	if *launchLocale != "" && !validLocale(*launchLocale) {
+		fmt.Fprintf(os.Stderr, "invalid --launch-locale %q\n", *launchLocale)
+		os.Exit(2)
+	}
+	launchOpt := launchOptions{Resume: *resume, Steps: defaultLaunchSteps, Display: *displayID, Locale: *launchLocale}
+	if *steps == "" && len(cfg.LaunchSteps) > 0 {
+		*steps = strings.Join(cfg.LaunchSteps, ",")
+	}
+	if *steps != "" {
+		if launchOpt.Steps, err = parseLaunchSteps(*steps); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
 	}
 
-	for _, p := range pkgs {
-		in <- p
+	if *resetSmart {
+		if err := resetHours(); err != nil {
+			fmt.Fprintln(os.Stderr, "cannot reset history:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *restoreLoc {
+		os.Exit(restoreLocales(ctx))
+	}
+	if *focus != "" {
+		os.Exit(focusCommand(cfg, *focus))
+	}
+	if *debugPkg != "" {
+		warnAapt()
+		os.Exit(debugProbe(ctx, *debugPkg))
+	}
+	if *missing != "" {
+		os.Exit(printMissing(ctx, *missing))
+	}
+	if *describePkg != "" {
+		warnAapt()
+		os.Exit(describe(ctx, cfg, *describePkg))
+	}
+	if *resolvePkg != "" {
+		os.Exit(printComponent(ctx, cfg, *resolvePkg))
+	}
+	if *launchPkg != "" {
+		warnAapt()
+		code := launchPackage(ctx, cfg, *launchPkg, launchOpt)
+		stats.ProbeFailures = int(probeFailures.Load())
+		stats.countLaunch(code)
+		exit(code)
 	}
-	close(in)
 
-	go func() {
-		wg.Wait()
-		close(out)
-	}()
+	if *toggleSystem {
+		last, err := readState("picker_system")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "cannot read picker state:", err)
+		}
+		*withSystem = last != "1"
+		if err := writeState("picker_system", boolState(*withSystem)); err != nil {
+			fmt.Fprintln(os.Stderr, "cannot save picker state:", err)
+		}
+	}
 
-	var apps []*AppInfo
-	for a := range out {
-		apps = append(apps, a)
+	// fail before the slow probe rather than leave fzf to fail without a
+	// terminal, e.g. under cron
+	interactive := !*jsonOut && !*list && !*listPackages && *export == "" && *nth == 0 && !*toggleSystem
+	if interactive && !hasTTY() {
+		fmt.Fprintln(os.Stderr, "no terminal for the picker; use --list, --json, --list-packages or --export"+
+			" to print apps, or --launch <pkg> to launch one")
+		os.Exit(2)
 	}
 
-	sort.Slice(apps, func(i, j int) bool {
-		return strings.ToLower(apps[i].Label) < strings.ToLower(apps[j].Label)
-	})
+	var pkgs []string
+	var system map[string]bool
+	if *withSystem {
+		pkgs, err = getPackages(ctx)
+		sys, serr := getPackages(ctx, "-s")
+		if serr != nil {
+			fmt.Fprintln(os.Stderr, "error listing system packages:", serr)
+		}
+		system = make(map[string]bool, len(sys))
+		for _, p := range sys {
+			system[p] = true
+		}
+	} else {
+		pkgs, err = getPackages(ctx, "-3")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error listing packages:", err)
+	}
+	if len(pkgs) == 0 {
+		fmt.Fprintln(os.Stderr, "no packages found")
+		exit(1)
+	}
+	pkgs = dropDistracting(cfg, pkgs)
+	if rules, err := ignoreRules(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "ignoring excludes:", err)
+	} else {
+		pkgs = dropIgnored(rules, pkgs)
+	}
+	if !*keepHome && !cfg.KeepHomeLauncher {
+		pkgs = dropHomeLauncher(ctx, pkgs)
+	}
 
-	var fzfInput bytes.Buffer
-	for _, a := range apps {
-		line := fmt.Sprintf("%s\t%s|%s\n", a.Label, a.Package, a.Main)
-		fzfInput.WriteString(line)
+	if *handles != "" {
+		handlers, err := mimeHandlers(ctx, *handles)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "cannot query handlers:", err)
+			exit(1)
+		}
+		pkgs = slices.DeleteFunc(pkgs, func(p string) bool { return !handlers[p] })
+		if len(pkgs) == 0 {
+			fmt.Fprintf(os.Stderr, "no apps handle %s\n", *handles)
+			exit(1)
+		}
 	}
 
-	fzfCmd := exec.Command("fzf", "--with-nth=1", "--delimiter=\t", "--layout=reverse")
-	fzfCmd.Stdin = &fzfInput
+	var installed map[string]time.Time
+	if *mode == "recently-installed" {
+		if installed, err = installTimes(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, "cannot read install times:", err)
+			exit(1)
+		}
+		// cut the list before probing so only the shown apps cost an aapt call
+		pkgs = recentlyInstalled(pkgs, installed, cmp.Or(*limit, defaultRecentLimit))
+		if len(pkgs) == 0 {
+			fmt.Fprintln(os.Stderr, "no install times found")
+			exit(1)
+		}
+	}
+
+	launchers, err := bulkLaunchers(ctx, *strategy)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "falling back to per-package resolution:", err)
+	}
+	if *listPackages {
+		kept := launchablePackages(ctx, cfg, pkgs, launchers)
+		for _, p := range kept {
+			fmt.Println(p)
+		}
+		stats.Packages, stats.Listed, stats.Launchable = len(pkgs), len(kept), len(kept)
+		if ctx.Err() != nil {
+			exit(exitCancelled)
+		}
+		exit(0)
+	}
+	warnAapt()
+	hist, err := loadHistory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ignoring launch history:", err)
+	}
+	if aaptBudget > 0 {
+		if labelCache, err = loadLabelCache(); err != nil {
+			fmt.Fprintln(os.Stderr, "ignoring label cache:", err)
+		}
+	}
+	probeStart := time.Now()
+	order := pkgs
+	if aaptBudget > 0 {
+		// the list only appears once every app is probed, so the order
+		// matters just for which apps the budget goes to
+		order = probeOrder(pkgs, launchers, hist)
+	}
+	apps := probeCalibrated(ctx, order, launchers, *recalibrate)
+	stats.ProbeDuration = time.Since(probeStart)
+	if over := aaptCalls.Load() - int64(aaptBudget); aaptBudget > 0 && over > 0 {
+		fmt.Fprintf(os.Stderr, "aapt budget of %d used up, %d apps show their package name\n", aaptBudget, over)
+	}
+	if ctx.Err() == nil {
+		if err := labelCache.save(); err != nil {
+			fmt.Fprintln(os.Stderr, "cannot save label cache:", err)
+		}
+	}
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "cancelled")
+		stats.countApps(len(pkgs), int(probeFailures.Load()), apps)
+		exit(exitCancelled)
+	}
+	for _, a := range apps {
+		a.System = system[a.Package]
+		cfg.overrideMain(a)
+	}
+	if *withSystem && !*systemComponents {
+		apps = dropSystemComponents(apps)
+	}
+	stats.countApps(len(pkgs), int(probeFailures.Load()), apps)
 
-	var chosenBuf bytes.Buffer
-	fzfCmd.Stdout = &chosenBuf
-	fzfCmd.Stderr = os.Stderr
-	if err := fzfCmd.Run(); err != nil {
-		os.Exit(1)
+	if *sortMode == "usage" || *tiebreak == "usage" {
+		if usageTimes, err = loadUsage(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, "usagestats not available, sorting by launch count:", err)
+		}
+	}
+	if installed != nil {
+		sortByInstallTime(apps, func(a *AppInfo) string { return a.Package }, installed)
+	} else if err := sortApps(apps, *sortMode, *tiebreak, *unlaunchLast, hist); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exit(2)
 	}
 
-	chosen := strings.TrimSpace(chosenBuf.String())
-	if chosen == "" {
-		os.Exit(1)
+	if *twoColumn {
+		if !slices.Contains(display.Columns, "package") {
+			display.Columns = append([]string{"package"}, display.Columns...)
+		}
+		display.alignLabels(apps)
 	}
 
-	parts := strings.SplitN(chosen, "\t", 2)
-	if len(parts) < 2 {
-		fmt.Fprintln(os.Stderr, "unexpected selection format")
-		os.Exit(1)
+	if *export != "" {
+		if err := exportApps(*export, flag.Arg(0), apps); err != nil {
+			fmt.Fprintln(os.Stderr, "export failed:", err)
+			exit(1)
+		}
+		exit(0)
 	}
 
-	line := parts[1]
-	pair := strings.SplitN(line, "|", 2)
-	if len(pair) < 2 {
-		fmt.Fprintln(os.Stderr, "unexpected package|main format")
-		os.Exit(1)
+	if *jsonOut || *list || *toggleSystem {
+		switch {
+		case *jsonOut:
+			err = writeJSON(os.Stdout, apps)
+		case *toggleSystem:
+			// the picker's top level, folders included
+			top, _, _, _ := topLevel(apps, cfg.Folders, display)
+			_, err = io.WriteString(os.Stdout, strings.Join(top, ""))
+		default:
+			err = writeList(os.Stdout, apps, display)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "write failed:", err)
+			exit(1)
+		}
+		exit(0)
 	}
 
-	pkg := pair[0]
-	intent := pair[1]
+	if *nth > 0 {
+		if *nth > len(apps) {
+			fmt.Fprintf(os.Stderr, "--nth %d is out of range: the list has %d apps\n", *nth, len(apps))
+			exit(2)
+		}
+		a := apps[*nth-1]
+		code := runLaunch(ctx, actionEnv{Cfg: cfg, Launch: launchOpt}, selection{Pkg: a.Package, Main: a.Main})
+		stats.countLaunch(code)
+		exit(code)
+	}
 
-	if intent == "UNKNOWN_MAIN" {
-		playstoreURL := "https://play.google.com/store/apps/details?id=" + pkg
-		exec.Command("termux-open-url", playstoreURL).Run()
-	} else {
-		amArgs := []string{"start", "--user", "0", "-n", fmt.Sprintf("%s/%s", pkg, intent)}
-		amCmd := exec.Command("am", amArgs...)
-		amCmd.Stdout = os.Stdout
-		amCmd.Stderr = os.Stderr
-		amCmd.Run()
+	// an explicit --query wins over positional words, which win over
+	// --restore-query
+	query := *initialQuery
+	if query == "" {
+		query = strings.Join(flag.Args(), " ")
+	}
+	if query != "" && *selectPkg != "" {
+		// --select places the cursor by line in the unfiltered list
+		fmt.Fprintln(os.Stderr, "ignoring the query: --select needs the full list")
+		query = ""
+	}
+	if query == "" && *restoreQuery && *selectPkg == "" {
+		if query, err = readState("last_query"); err != nil {
+			fmt.Fprintln(os.Stderr, "cannot read last query:", err)
+		}
+	}
+	if err := writeState("picker_system", boolState(*withSystem)); err != nil {
+		fmt.Fprintln(os.Stderr, "cannot save picker state:", err)
+	}
+	// what the reload key needs to print this list again, minus --system
+	reload := []string{"--user", androidUser, "--strategy", *strategy,
+		"--sort", *sortMode, "--sort-tiebreak", *tiebreak,
+		"--show", *show, "--sep", *sep, "--max-label", strconv.Itoa(*maxLabel)}
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"--two-column", *twoColumn},
+		{"--unlaunchable-last", *unlaunchLast},
+		{"--system-components", *systemComponents},
+		{"--keep-home", *keepHome},
+		{"--verify-activities", verifyMains},
+	} {
+		if f.set {
+			reload = append(reload, f.name)
+		}
+	}
+	if *handles != "" {
+		reload = append(reload, "--handles", *handles)
+	}
+	if *mode != "" {
+		reload = append(reload, "--mode", *mode, "--limit", strconv.Itoa(*limit))
+	}
+	if aaptBudget > 0 {
+		reload = append(reload, "--aapt-budget", strconv.Itoa(aaptBudget))
+	}
+	sel, err := pick(apps, pickOptions{
+		Display: display,
+		Folders: cfg.Folders,
+		Query:   query,
+		Select:  *selectPkg,
+		Preview: *preview,
+		Reload:  reload,
+		OnQuery: func(q string) {
+			if err := writeState("last_query", q); err != nil {
+				fmt.Fprintln(os.Stderr, "cannot save last query:", err)
+			}
+		},
+	})
+	if err != nil {
+		if err != errAborted {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		exit(1)
+	}
+	act := findAction(sel.Key)
+	if *copyCmd && sel.Key == "" {
+		act = findAction("ctrl-y")
+	}
+	if *printURI && sel.Key == "" {
+		act = findAction("ctrl-o")
+	}
+	if act == nil || act.Run == nil {
+		fmt.Fprintf(os.Stderr, "no action bound to %q\n", sel.Key)
+		exit(1)
+	}
+	code := act.Run(ctx, actionEnv{Cfg: cfg, Launch: launchOpt}, sel)
+	if act.Key == "" {
+		stats.countLaunch(code)
 	}
+	exit(code)
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGetPackagesMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		err  error
+		want []string
+	}{
+		{"plain", "package:com.a\npackage:com.b\n", nil, []string{"com.a", "com.b"}},
+		{"crlf and bom", "\uFEFFpackage:com.a\r\npackage:com.b\r\n", nil, []string{"com.a", "com.b"}},
+		{"nul padding", "package:com.a\x00\n\x00package:com.b\n", nil, []string{"com.a", "com.b"}},
+		{"blank lines", "\n\npackage:com.a\n   \n", nil, []string{"com.a"}},
+		{"duplicates", "package:com.a\npackage:com.a\n", nil, []string{"com.a"}},
+		{"interleaved warnings", "WARNING: linker: unused DT entry\npackage:com.a\n" +
+			"Failure calling service package: Broken pipe (32)\npackage:com.b\n", nil, []string{"com.a", "com.b"}},
+		{"no prefix", "com.a\n", nil, []string{"com.a"}},
+		{"space after prefix", "package: com.a\n", nil, []string{"com.a"}},
+		{"truncated", "package:com.a\npackage:", nil, []string{"com.a"}},
+		{"bad names", "package:1com\npackage:com-a\npackage:.com\npackage:com/a\n", nil, nil},
+		{"partial output with error", "package:com.a\n", errors.New("signal: killed"), []string{"com.a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useRunner(t, &fakeRunner{fn: func(ctx context.Context, name string, args []string) (string, string, error) {
+				return tt.out, "", tt.err
+			}})
+			got, err := getPackages(context.Background(), "-3")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("getPackages = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPackagesError(t *testing.T) {
+	useRunner(t, &fakeRunner{fn: func(ctx context.Context, name string, args []string) (string, string, error) {
+		return "Error: java.lang.SecurityException: Shell does not have permission to access user 10", "", errors.New("exit status 255")
+	}})
+	pkgs, err := getPackages(context.Background())
+	if err == nil {
+		t.Fatalf("getPackages = %q, want an error", pkgs)
+	}
+	if msg := err.Error(); !strings.HasPrefix(msg, "pm list packages: exit status 255: ") || !strings.Contains(msg, "SecurityException") {
+		t.Errorf("error = %q, want the exit status and pm's output", msg)
+	}
+}
+
+func TestTrimPrefixed(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"package:com.a", "com.a"},
+		{"  package:com.a  ", "com.a"},
+		{"\uFEFFpackage:com.a\r", "com.a"},
+		{"\x00package:\x00com.a\x00", "com.a"},
+		{"package:", ""},
+		{"com.a", "com.a"},
+		{"package:package:com.a", "package:com.a"},
+	}
+	for _, tt := range tests {
+		if got := trimPrefixed(tt.in, "package:"); got != tt.want {
+			t.Errorf("trimPrefixed(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsPackageName(t *testing.T) {
+	for _, s := range []string{"com.termux", "a", "com.example_app.v2", "Com.Foo", "android"} {
+		if !isPackageName(s) {
+			t.Errorf("isPackageName(%q) = false", s)
+		}
+	}
+	for _, s := range []string{"", "1com", ".com", "_com", "com-a", "com a", "com/a", "WARNING:", "com.a\r", "相机"} {
+		if isPackageName(s) {
+			t.Errorf("isPackageName(%q) = true", s)
+		}
+	}
+}
+
+func TestPackageToken(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"com.foo", "com.foo"},
+		{"com.foo  uid:10123", "com.foo"},
+		{"com.foo uid:10123 installer=com.android.vending", "com.foo"},
+		{"com.foo\tinstaller=com.android.vending", "com.foo"},
+		{"com.foo uid:10123", "com.foo"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := packageToken(tt.in); got != tt.want {
+			t.Errorf("packageToken(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	out := "package:com.a  uid:10123\n" +
+		"package:com.b\tinstaller=com.android.vending\n" +
+		"package:com.a uid:10123\n"
+	if got, want := parsePackageList(out), []string{"com.a", "com.b"}; !slices.Equal(got, want) {
+		t.Errorf("parsePackageList = %q, want %q", got, want)
+	}
+}
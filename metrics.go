@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runMetrics are the counters --metrics appends after each run.
+type runMetrics struct {
+	Start         time.Time
+	ProbeDuration time.Duration
+	Packages      int
+	Listed        int
+	Launchable    int
+	ProbeFailures int
+	LaunchOK      int
+	LaunchFailed  int
+}
+
+// countApps fills the app counters from the number of packages probed,
+// how many of those probes had a failing command and the apps left after
+// filtering.
+func (m *runMetrics) countApps(pkgs, failures int, listed []*AppInfo) {
+	m.Packages = pkgs
+	m.ProbeFailures = failures
+	m.Listed = len(listed)
+	m.Launchable = 0
+	for _, a := range listed {
+		if a.Main != "UNKNOWN_MAIN" {
+			m.Launchable++
+		}
+	}
+}
+
+// countLaunch counts a launch by its exit status.
+func (m *runMetrics) countLaunch(code int) {
+	if code == 0 {
+		m.LaunchOK++
+	} else {
+		m.LaunchFailed++
+	}
+}
+
+// append writes the counters to metrics.prom in the state dir in the
+// Prometheus text exposition format, one timestamped sample per metric.
+// The file is only ever appended to.
+func (m *runMetrics) append() error {
+	p, err := stateFile("metrics.prom")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	ts := time.Now().UnixMilli()
+	var b strings.Builder
+	fmt.Fprintf(&b, "# run %s\n", m.Start.Format(time.RFC3339))
+	sample := func(name string, v any) {
+		fmt.Fprintf(&b, "drawercli_%s{user=%q} %v %d\n", name, androidUser, v, ts)
+	}
+	sample("packages_total", m.Packages)
+	sample("apps_listed", m.Listed)
+	sample("apps_launchable", m.Launchable)
+	sample("probe_failures_total", m.ProbeFailures)
+	sample("launch_success_total", m.LaunchOK)
+	sample("launch_failure_total", m.LaunchFailed)
+	sample("probe_duration_seconds", m.ProbeDuration.Seconds())
+	sample("run_duration_seconds", time.Since(m.Start).Seconds())
+
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readPackageList reads one package name per line. Blank lines and
+// everything after a '#' are ignored.
+func readPackageList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pkgs []string
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		l, _, _ := strings.Cut(sc.Text(), "#")
+		l = strings.TrimFunc(l, isJunk)
+		if l == "" {
+			continue
+		}
+		if !isPackageName(l) {
+			return nil, fmt.Errorf("%s:%d: %q is not a package name", path, n, l)
+		}
+		pkgs = append(pkgs, l)
+	}
+	return pkgs, sc.Err()
+}
+
+// missingPackages returns the packages of expected that are not in
+// installed, in template order and without duplicates.
+func missingPackages(expected, installed []string) []string {
+	have := make(map[string]bool, len(installed))
+	for _, p := range installed {
+		have[p] = true
+	}
+	var missing []string
+	for _, p := range expected {
+		if !have[p] {
+			missing = append(missing, p)
+			have[p] = true
+		}
+	}
+	return missing
+}
+
+// printMissing lists the packages of a template file that are not
+// installed, for --missing. Only the package list is needed, so nothing is
+// probed. It returns 1 when something is missing and 2 when the template
+// or the package list cannot be read.
+func printMissing(ctx context.Context, template string) int {
+	expected, err := readPackageList(template)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	// without the installed list every package would look missing
+	installed, err := getPackages(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error listing packages:", err)
+		return 2
+	}
+	missing := missingPackages(expected, installed)
+	for _, p := range missing {
+		fmt.Println(p)
+	}
+	if len(missing) > 0 {
+		return 1
+	}
+	return 0
+}
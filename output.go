@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+	"unicode/utf8"
+)
+
+// displayOptions controls the visible part of picker lines.
+type displayOptions struct {
+	// Sep goes between the label and each extra column.
+	Sep string
+	// Columns are shown after the label: "package", "activity" and/or
+	// "size".
+	Columns []string
+	// MaxLabel truncates labels longer than this many runes; 0 keeps
+	// them whole.
+	MaxLabel int
+	// LabelWidth pads labels to this many terminal cells so the columns
+	// after them line up; see alignLabels.
+	LabelWidth int
+}
+
+// displayColumns are the values accepted by --show.
+var displayColumns = map[string]func(a *AppInfo) string{
+	"package": func(a *AppInfo) string { return a.Package },
+	"activity": func(a *AppInfo) string {
+		if a.Main == "UNKNOWN_MAIN" {
+			return "-"
+		}
+		return a.Main
+	},
+	"size": func(a *AppInfo) string { return formatSize(a.Size) },
+}
+
+// formatSize prints n bytes the way ls -h does, "-" when unknown.
+func formatSize(n int64) string {
+	if n <= 0 {
+		return "-"
+	}
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	f, i := float64(n)/unit, 0
+	for f >= unit && i < 3 {
+		f /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f%c", f, "KMGT"[i])
+}
+
+// parseDisplay validates --sep and --show. The separator may not contain
+// tabs or newlines: the tab starts the hidden payload and a newline would
+// split the line.
+func parseDisplay(sep, show string, maxLabel int) (displayOptions, error) {
+	if strings.ContainsAny(sep, "\t\n\r") {
+		return displayOptions{}, fmt.Errorf("--sep may not contain tabs or newlines")
+	}
+	if maxLabel < 0 {
+		return displayOptions{}, fmt.Errorf("--max-label must not be negative")
+	}
+	d := displayOptions{Sep: sep, MaxLabel: maxLabel}
+	for _, c := range strings.Split(show, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if displayColumns[c] == nil {
+			return displayOptions{}, fmt.Errorf("unknown --show column %q (want package, activity or size)", c)
+		}
+		d.Columns = append(d.Columns, c)
+	}
+	return d, nil
+}
+
+// ellipsis marks a label shortened by --max-label.
+const ellipsis = "…"
+
+// label returns the label of a as shown, cut to MaxLabel runes, and whether
+// it was cut. Counting runes keeps multibyte labels from being split inside
+// a character.
+func (d displayOptions) label(a *AppInfo) (string, bool) {
+	l := displayLabel(a.Label)
+	if d.MaxLabel <= 0 || utf8.RuneCountInString(l) <= d.MaxLabel {
+		return l, false
+	}
+	r := []rune(l)
+	return strings.TrimSpace(string(r[:max(d.MaxLabel-1, 0)])) + ellipsis, true
+}
+
+// wideRanges are the East Asian wide and fullwidth blocks and the emoji
+// that terminals draw two cells wide. In the symbol and dingbat blocks
+// only the code points with East Asian Width W are listed: ★, ♥ or ☀ are
+// one cell. isWide needs the ranges sorted.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f}, {0x231a, 0x231b}, {0x2329, 0x232a}, {0x23e9, 0x23ec},
+	{0x23f0, 0x23f0}, {0x23f3, 0x23f3},
+	// Miscellaneous Symbols and Dingbats
+	{0x2614, 0x2615}, {0x2648, 0x2653}, {0x267f, 0x267f}, {0x2693, 0x2693},
+	{0x26a1, 0x26a1}, {0x26aa, 0x26ab}, {0x26bd, 0x26be}, {0x26c4, 0x26c5},
+	{0x26ce, 0x26ce}, {0x26d4, 0x26d4}, {0x26ea, 0x26ea}, {0x26f2, 0x26f3},
+	{0x26f5, 0x26f5}, {0x26fa, 0x26fa}, {0x26fd, 0x26fd}, {0x2705, 0x2705},
+	{0x270a, 0x270b}, {0x2728, 0x2728}, {0x274c, 0x274c}, {0x274e, 0x274e},
+	{0x2753, 0x2755}, {0x2757, 0x2757}, {0x2795, 0x2797}, {0x27b0, 0x27b0},
+	{0x27bf, 0x27bf}, {0x2b1b, 0x2b1c}, {0x2b50, 0x2b50}, {0x2b55, 0x2b55},
+	{0x2e80, 0x303e}, {0x3041, 0x33ff}, {0x3400, 0x4dbf}, {0x4e00, 0x9fff},
+	{0xa000, 0xa4cf}, {0xac00, 0xd7a3}, {0xf900, 0xfaff}, {0xfe30, 0xfe4f},
+	{0xff00, 0xff60}, {0xffe0, 0xffe6},
+	// Mahjong and playing cards, enclosed alphanumerics and ideographs
+	{0x1f004, 0x1f004}, {0x1f0cf, 0x1f0cf}, {0x1f18e, 0x1f18e}, {0x1f191, 0x1f19a},
+	{0x1f200, 0x1f202}, {0x1f210, 0x1f23b}, {0x1f240, 0x1f248}, {0x1f250, 0x1f251},
+	{0x1f260, 0x1f265},
+	// emoji blocks
+	{0x1f300, 0x1f64f}, {0x1f680, 0x1f6ff}, {0x1f7e0, 0x1f7f0}, {0x1f900, 0x1f9ff},
+	{0x1fa70, 0x1faff},
+	{0x20000, 0x2fffd}, {0x30000, 0x3fffd},
+}
+
+// cellWidth returns how many terminal cells s takes: two for wide
+// characters, none for combining marks and zero-width characters.
+func cellWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		case isWide(r):
+			w += 2
+		default:
+			w++
+		}
+	}
+	return w
+}
+
+func isWide(r rune) bool {
+	for _, rg := range wideRanges {
+		if r < rg[0] {
+			return false
+		}
+		if r <= rg[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// alignLabels sets LabelWidth to the widest label among apps, for
+// --two-column.
+func (d *displayOptions) alignLabels(apps []*AppInfo) {
+	d.LabelWidth = 0
+	for _, a := range apps {
+		l, _ := d.label(a)
+		d.LabelWidth = max(d.LabelWidth, cellWidth(l))
+	}
+}
+
+// visible returns the text shown for a in the picker.
+func (d displayOptions) visible(a *AppInfo) string {
+	l, _ := d.label(a)
+	if len(d.Columns) > 0 {
+		if pad := d.LabelWidth - cellWidth(l); pad > 0 {
+			l += strings.Repeat(" ", pad)
+		}
+	}
+	parts := []string{l}
+	for _, c := range d.Columns {
+		parts = append(parts, displayLabel(displayColumns[c](a)))
+	}
+	return strings.Join(parts, d.Sep)
+}
+
+// fzfLine encodes an app as a picker line: the visible text, a tab, then
+// the hidden "package|main" payload read back after selection. A label cut
+// by --max-label follows in a third field so the whole label can still be
+// searched; fzf shows it past the columns, off-screen on narrow terminals.
+func (d displayOptions) fzfLine(a *AppInfo) string {
+	if _, cut := d.label(a); cut {
+		return fmt.Sprintf("%s\t%s|%s\t%s\n", d.visible(a), a.Package, a.Main, displayLabel(a.Label))
+	}
+	return fmt.Sprintf("%s\t%s|%s\n", d.visible(a), a.Package, a.Main)
+}
+
+// isTerminal reports whether f is an interactive terminal rather than a
+// pipe or file.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// hasTTY reports whether the process has a controlling terminal for fzf to
+// draw on. fzf uses /dev/tty, so piped stdin or stdout do not matter.
+func hasTTY() bool {
+	f, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// writeList prints apps for --list. When w is piped into fzf or another
+// selector it gets the picker encoding; on a terminal a readable table is
+// printed instead so the payload format never leaks to users.
+func writeList(w *os.File, apps []*AppInfo, d displayOptions) error {
+	if !isTerminal(w) {
+		for _, a := range apps {
+			if _, err := io.WriteString(w, d.fzfLine(a)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LABEL\tPACKAGE\tACTIVITY")
+	for _, a := range apps {
+		main := a.Main
+		if main == "UNKNOWN_MAIN" {
+			main = "-"
+		}
+		l, _ := d.label(a)
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", l, a.Package, main)
+	}
+	return tw.Flush()
+}
+
+type appJSON struct {
+	Label      string `json:"label"`
+	Package    string `json:"package"`
+	Main       string `json:"main,omitempty"`
+	Launchable bool   `json:"launchable"`
+	Size       int64  `json:"size,omitempty"`
+}
+
+// writeJSON prints apps as a JSON array for --json.
+func writeJSON(w io.Writer, apps []*AppInfo) error {
+	out := make([]appJSON, 0, len(apps))
+	for _, a := range apps {
+		j := appJSON{Label: a.Label, Package: a.Package, Size: a.Size}
+		if a.Main != "UNKNOWN_MAIN" {
+			j.Main = a.Main
+			j.Launchable = true
+		}
+		out = append(out, j)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
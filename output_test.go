@@ -0,0 +1,91 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCellWidth(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"Maps", 4},
+		{"", 0},
+		{"Café", 4},
+		{"Cafe\u0301", 4}, // combining acute accent
+		{"\u200bA", 1},    // zero-width space
+		{"微信", 4},
+		{"カメラ", 6},
+		{"ｶﾒﾗ", 3}, // halfwidth katakana
+		{"ＡＢ", 4},  // fullwidth latin
+		{"카카오톡", 8},
+		{"𠀀", 2}, // CJK extension B
+		{"🎵 Music", 8},
+		{"😀", 2},
+		{"🚀", 2}, // transport and map symbols
+		{"🛸", 2}, // end of that block
+		{"🤖", 2}, // supplemental symbols
+		{"🩰", 2}, // symbols and pictographs extended-A
+		{"🫠", 2},
+		{"☀", 1}, // miscellaneous symbols are narrow but for emoji
+		{"★", 1},
+		{"♥", 1},
+		{"☔", 2},
+		{"♈", 2},
+		{"⚡", 2},
+		{"⛔", 2},
+		{"⛽", 2},
+		{"✔", 1}, // dingbats likewise
+		{"✅", 2},
+		{"✨", 2},
+		{"❌", 2},
+		{"➕", 2},
+		{"⭐", 2},
+		{"⌚", 2},
+		{"🀄", 2}, // mahjong tile
+		{"🃏", 2},
+		{"🆎", 2},
+		{"🅰", 1}, // enclosed letter without emoji presentation
+		{"🈁", 2},
+		{"🉐", 2},
+		{"🟢", 2},
+		{"🙏🏽", 4}, // skin tone modifier is its own wide rune
+		{"→", 1},
+	}
+	for _, tt := range tests {
+		if got := cellWidth(tt.s); got != tt.want {
+			t.Errorf("cellWidth(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestWideRangesSorted(t *testing.T) {
+	if !slices.IsSortedFunc(wideRanges, func(a, b [2]rune) int { return int(a[0] - b[0]) }) {
+		t.Fatal("wideRanges is not sorted, isWide stops early")
+	}
+	for i, rg := range wideRanges {
+		if rg[0] > rg[1] || i > 0 && rg[0] <= wideRanges[i-1][1] {
+			t.Errorf("range %U-%U overlaps or is reversed", rg[0], rg[1])
+		}
+	}
+}
+
+func TestAlignLabelsWide(t *testing.T) {
+	apps := []*AppInfo{
+		{Label: "微信", Package: "com.tencent.mm"},
+		{Label: "🚀 Go", Package: "com.go"},
+		{Label: "Mail", Package: "com.mail"},
+	}
+	d := displayOptions{Sep: " ", Columns: []string{"package"}}
+	d.alignLabels(apps)
+	if d.LabelWidth != 5 {
+		t.Fatalf("LabelWidth = %d, want 5", d.LabelWidth)
+	}
+	want := []string{"微信  com.tencent.mm", "🚀 Go com.go", "Mail  com.mail"}
+	for i, a := range apps {
+		if got := d.visible(a); got != want[i] {
+			t.Errorf("visible(%s) = %q, want %q", a.Package, got, want[i])
+		}
+	}
+}
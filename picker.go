@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Payload markers for picker lines that are not apps. '@' never appears
+// in a package name.
+const (
+	folderPayload = "@folder"
+	backPayload   = "@back"
+)
+
+// pickOptions configure pick.
+type pickOptions struct {
+	Display displayOptions
+	Folders map[string][]string
+	// Query is the initial fzf query.
+	Query string
+	// Select is a package to put the cursor on when the picker opens. If
+	// it is inside a folder the cursor goes to that folder. It is a line
+	// number in the unfiltered list, so callers must not set Query too.
+	Select string
+	// Preview shows --describe output for the app under the cursor.
+	Preview bool
+	// OnQuery receives each top-level query so it can be persisted.
+	OnQuery func(string)
+	// Reload are the arguments that make this program print the current
+	// list with --toggle-system. When set, toggleSystemKey reloads the top
+	// level with system apps switched on or off. Folders opened after a
+	// reload still hold the apps pick was given.
+	Reload []string
+}
+
+// toggleSystemKey reloads the picker with system apps toggled.
+const toggleSystemKey = "alt-s"
+
+// reloadArgs returns the fzf binding of toggleSystemKey. The reload:
+// form takes the rest of the option as the command, so arguments may
+// contain the parentheses reload(...) could not.
+func reloadArgs(args []string) []string {
+	self, err := os.Executable()
+	if err != nil || args == nil {
+		return nil
+	}
+	cmd := []string{shellQuote(self)}
+	for _, a := range args {
+		cmd = append(cmd, shellQuote(a))
+	}
+	cmd = append(cmd, "--toggle-system")
+	return []string{"--bind=" + toggleSystemKey + ":reload:" + strings.Join(cmd, " ")}
+}
+
+// previewArgs returns the fzf options running --describe on the payload
+// of the focused line.
+func previewArgs() []string {
+	self, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	return []string{"--preview=" + shellQuote(self) + " --user " + androidUser + " --describe {2}",
+		"--preview-window=down,40%,wrap"}
+}
+
+// selection is the app chosen in the picker and the key that chose it
+// (empty for enter).
+type selection struct {
+	Key  string
+	Pkg  string
+	Main string
+}
+
+var errAborted = errors.New("aborted")
+
+// runFzf feeds lines to fzf with the picker options plus extra, and
+// returns the final query, the --expect key pressed and the chosen line.
+func runFzf(lines []string, extra ...string) (query, key, chosen string, err error) {
+	args := append([]string{"--with-nth=1,3", "--delimiter=\t", "--layout=reverse", "--print-query",
+		expectArg()}, extra...)
+	fzfCmd := exec.Command("fzf", args...)
+	fzfCmd.Stdin = strings.NewReader(strings.Join(lines, ""))
+
+	var chosenBuf bytes.Buffer
+	fzfCmd.Stdout = &chosenBuf
+	fzfCmd.Stderr = os.Stderr
+	fzfErr := fzfCmd.Run()
+
+	// --print-query puts the query first and --expect the key pressed
+	// (empty for enter) second, then the selected line
+	fzfOut := strings.SplitN(strings.TrimRight(chosenBuf.String(), "\n"), "\n", 3)
+	query = fzfOut[0]
+	if fzfErr != nil || len(fzfOut) < 3 || strings.TrimSpace(fzfOut[2]) == "" {
+		return query, "", "", errAborted
+	}
+	return query, fzfOut[1], strings.TrimSpace(fzfOut[2]), nil
+}
+
+// parsePayload splits a picker line into the two halves of its hidden
+// "package|main" payload.
+func parsePayload(line string) (pkg, main string, err error) {
+	parts := strings.SplitN(line, "\t", 3)
+	if len(parts) < 2 {
+		return "", "", errors.New("unexpected selection format")
+	}
+	pair := strings.SplitN(parts[1], "|", 2)
+	if len(pair) < 2 {
+		return "", "", errors.New("unexpected package|main format")
+	}
+	return pair[0], pair[1], nil
+}
+
+// pick shows the picker until an app is chosen. Configured folders are
+// listed first, followed by apps that are in no folder; choosing a folder
+// opens a second level with its apps, and leaving that level (esc or the
+// ".." entry) returns to the top. An app may be in several folders.
+// Without fzf the simpler pickBuiltin is used.
+func pick(apps []*AppInfo, opt pickOptions) (selection, error) {
+	if _, err := exec.LookPath("fzf"); err != nil {
+		fmt.Fprintln(os.Stderr, "fzf not found, using the built-in search")
+		return pickBuiltin(apps, opt)
+	}
+	d := opt.Display
+	top, names, byFolder, loose := topLevel(apps, opt.Folders, d)
+
+	reload := reloadArgs(opt.Reload)
+	header := headerHint("", reload)
+	if len(names) > 0 {
+		header = headerHint("launch or open folder", reload)
+	}
+	pos := 0
+	if opt.Select != "" {
+		pos = selectPosition(opt.Select, names, byFolder, loose)
+		if pos == 0 {
+			fmt.Fprintf(os.Stderr, "%s is not in the list\n", opt.Select)
+		}
+	}
+	var preview []string
+	if opt.Preview {
+		preview = previewArgs()
+	}
+	query := opt.Query
+	for {
+		extra := append([]string{"--header=" + header}, preview...)
+		extra = append(extra, reload...)
+		if query != "" {
+			extra = append(extra, "--query="+query)
+		}
+		if pos > 0 {
+			// needs fzf 0.36+; older versions just keep the cursor on top.
+			// Unbinding stops an alt-s reload jumping to a stale position.
+			extra = append(extra, fmt.Sprintf("--bind=load:pos(%d)+unbind(load)", pos))
+		}
+		q, key, chosen, err := runFzf(top, extra...)
+		if (err == nil || q != "") && opt.OnQuery != nil {
+			opt.OnQuery(q)
+		}
+		pos = 0 // only preselect when the picker first opens
+		if err != nil {
+			return selection{}, err
+		}
+		query = q
+		pkg, main, err := parsePayload(chosen)
+		if err != nil {
+			return selection{}, err
+		}
+		if pkg != folderPayload {
+			return selection{Key: key, Pkg: pkg, Main: main}, nil
+		}
+
+		lines := []string{fmt.Sprintf("..\t%s|\n", backPayload)}
+		for _, a := range byFolder[main] {
+			lines = append(lines, d.fzfLine(a))
+		}
+		_, key, chosen, err = runFzf(lines, append([]string{"--header=" + main + " (esc: back)", "--prompt=" + main + "> "}, preview...)...)
+		if err != nil {
+			continue
+		}
+		pkg, appMain, err := parsePayload(chosen)
+		if err != nil {
+			return selection{}, err
+		}
+		if pkg == backPayload {
+			continue
+		}
+		return selection{Key: key, Pkg: pkg, Main: appMain}, nil
+	}
+}
+
+// topLevel builds the lines of the top level picker: the folders holding
+// any of apps, sorted by name, then the apps in no folder. It also returns
+// the folder names in that order and the grouping they come from. The
+// reload key prints the same lines, so folders survive toggling system
+// apps.
+func topLevel(apps []*AppInfo, folders map[string][]string, d displayOptions) (lines, names []string, byFolder map[string][]*AppInfo, loose []*AppInfo) {
+	byFolder, loose = groupFolders(apps, folders)
+	names = make([]string, 0, len(byFolder))
+	for name := range byFolder {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s/\t%s|%s\n", displayLabel(name), folderPayload, name))
+	}
+	for _, a := range loose {
+		lines = append(lines, d.fzfLine(a))
+	}
+	return lines, names, byFolder, loose
+}
+
+// selectPosition returns the 1-based line of the top level picker where
+// pkg, or the first folder holding it, is listed, or 0 if it is not.
+func selectPosition(pkg string, names []string, byFolder map[string][]*AppInfo, loose []*AppInfo) int {
+	for i, a := range loose {
+		if a.Package == pkg {
+			return len(names) + i + 1
+		}
+	}
+	for i, name := range names {
+		for _, a := range byFolder[name] {
+			if a.Package == pkg {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// groupFolders splits apps into the configured folders, keeping the app
+// order, and returns the apps that belong to no folder. Folders with no
+// installed apps are left out.
+func groupFolders(apps []*AppInfo, folders map[string][]string) (map[string][]*AppInfo, []*AppInfo) {
+	member := map[string][]string{}
+	for name, pkgs := range folders {
+		for _, p := range pkgs {
+			member[p] = append(member[p], name)
+		}
+	}
+	byFolder := map[string][]*AppInfo{}
+	var loose []*AppInfo
+	for _, a := range apps {
+		in := member[a.Package]
+		if len(in) == 0 {
+			loose = append(loose, a)
+			continue
+		}
+		for _, name := range in {
+			byFolder[name] = append(byFolder[name], a)
+		}
+	}
+	return byFolder, loose
+}
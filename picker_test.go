@@ -0,0 +1,44 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTopLevel(t *testing.T) {
+	apps := []*AppInfo{
+		{Label: "Maps", Package: "com.maps", Main: ".Main"},
+		{Label: "Chat", Package: "com.chat", Main: ".Main"},
+		{Label: "Mail", Package: "com.mail", Main: ".Main"},
+	}
+	folders := map[string][]string{
+		"Work":  {"com.mail", "com.chat"},
+		"Empty": {"com.missing"},
+		"Apps":  {"com.chat"},
+	}
+	lines, names, byFolder, loose := topLevel(apps, folders, displayOptions{Sep: "  "})
+
+	want := []string{
+		"Apps/\t@folder|Apps\n",
+		"Work/\t@folder|Work\n",
+		"Maps\tcom.maps|.Main\n",
+	}
+	if !slices.Equal(lines, want) {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+	if !slices.Equal(names, []string{"Apps", "Work"}) {
+		t.Errorf("names = %q", names)
+	}
+	if len(byFolder["Work"]) != 2 || byFolder["Work"][0].Package != "com.chat" {
+		t.Errorf("Work holds %v, want chat then mail in app order", byFolder["Work"])
+	}
+	if len(loose) != 1 || loose[0].Package != "com.maps" {
+		t.Errorf("loose = %v", loose)
+	}
+	if got := selectPosition("com.mail", names, byFolder, loose); got != 2 {
+		t.Errorf("selectPosition(com.mail) = %d, want the Work folder on line 2", got)
+	}
+	if got := selectPosition("com.maps", names, byFolder, loose); got != 3 {
+		t.Errorf("selectPosition(com.maps) = %d, want 3", got)
+	}
+}
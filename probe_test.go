@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProbeAllProbesEveryPackage(t *testing.T) {
+	const limit = 3
+	var running, peak atomic.Int32
+	r := &fakeRunner{fn: func(ctx context.Context, name string, args []string) (string, string, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(time.Millisecond)
+		pkg := args[len(args)-1]
+		switch {
+		case name == "pm" && args[0] == "resolve-activity":
+			return "priority=0 preferredOrder=0\n  name=" + pkg + ".Main\n", "", nil
+		case name == "pm" && args[0] == "path":
+			return "", "", errors.New("exit status 1")
+		}
+		return "", "", fmt.Errorf("unexpected %s %q", name, args)
+	}}
+	useRunner(t, r)
+	t.Cleanup(func() { probeFailures.Store(0) })
+
+	var pkgs []string
+	for i := range 20 {
+		pkgs = append(pkgs, fmt.Sprintf("com.app%d", i))
+	}
+	launchers := map[string]string{"com.app0": "com.app0.Known"}
+	apps := probeAll(context.Background(), pkgs, limit, launchers)
+
+	if len(apps) != len(pkgs) {
+		t.Fatalf("got %d apps for %d packages", len(apps), len(pkgs))
+	}
+	for i, a := range apps {
+		if a.Package != pkgs[i] {
+			t.Errorf("app %d is %s, want %s in input order", i, a.Package, pkgs[i])
+		}
+	}
+	if got := apps[0].Main; got != "com.app0.Known" {
+		t.Errorf("com.app0 main = %q, want the bulk strategy's", got)
+	}
+	if got := apps[5].Main; got != "com.app5.Main" {
+		t.Errorf("com.app5 main = %q, want the resolved one", got)
+	}
+	for _, pkg := range pkgs {
+		if n := len(r.called("pm path " + pkg + " ")); n != 1 {
+			t.Errorf("pm path ran %d times for %s", n, pkg)
+		}
+	}
+	if n := len(r.called("pm resolve-activity")); n != len(pkgs)-1 {
+		t.Errorf("pm resolve-activity ran %d times, want %d", n, len(pkgs)-1)
+	}
+	if p := peak.Load(); p > limit {
+		t.Errorf("%d commands ran at once, limit is %d", p, limit)
+	}
+}
+
+func TestProbeAllCountsFailures(t *testing.T) {
+	useRunner(t, &fakeRunner{fn: func(ctx context.Context, name string, args []string) (string, string, error) {
+		return "", "", errors.New("exit status 1")
+	}})
+	probeFailures.Store(0)
+	t.Cleanup(func() { probeFailures.Store(0) })
+
+	apps := probeAll(context.Background(), []string{"com.a", "com.b"}, 2, nil)
+	if len(apps) != 2 {
+		t.Fatalf("got %d apps, want both listed with fallbacks", len(apps))
+	}
+	for _, a := range apps {
+		if a.Label != a.Package || a.Main != "UNKNOWN_MAIN" {
+			t.Errorf("%s: got label %q main %q, want the fallbacks", a.Package, a.Label, a.Main)
+		}
+	}
+	if n := probeFailures.Load(); n != 2 {
+		t.Errorf("probeFailures = %d, want 2", n)
+	}
+
+	m := &runMetrics{}
+	m.countApps(2, int(probeFailures.Load()), apps)
+	if m.ProbeFailures != 2 || m.Listed != 2 || m.Launchable != 0 {
+		t.Errorf("metrics = %+v", m)
+	}
+}
+
+func TestApkSizeSplits(t *testing.T) {
+	dir := t.TempDir()
+	sizes := map[string]int{
+		"base.apk":                   1000,
+		"split_config.arm64_v8a.apk": 300,
+		"split_config.xxhdpi.apk":    20,
+		"split_config.en.apk":        4,
+		"split_feature_camera.apk":   5000,
+	}
+	var paths []string
+	for name, n := range sizes {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, make([]byte, n), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+	if got := apkSize(paths); got != 6324 {
+		t.Errorf("apkSize = %d, want every split counted", got)
+	}
+	if got := apkSize(append(paths, filepath.Join(dir, "gone.apk"))); got != 6324 {
+		t.Errorf("apkSize with an unreadable split = %d, want it skipped", got)
+	}
+	if got := apkSize(nil); got != 0 {
+		t.Errorf("apkSize(nil) = %d", got)
+	}
+
+	// probe reads the splits from pm path, base first or not
+	useRunner(t, &fakeRunner{fn: func(ctx context.Context, name string, args []string) (string, string, error) {
+		if name == "pm" && args[0] == "path" {
+			return "package:" + filepath.Join(dir, "split_config.en.apk") + "\n" +
+				"package:" + filepath.Join(dir, "base.apk") + "\n" +
+				"package:" + filepath.Join(dir, "split_feature_camera.apk") + "\n", "", nil
+		}
+		return "", "", errors.New("exit status 1")
+	}})
+	t.Cleanup(func() { probeFailures.Store(0) })
+	info, _ := probePackage(context.Background(), "com.foo", "com.foo.Main")
+	if info.Size != 6004 {
+		t.Errorf("probed size = %d, want base and both splits", info.Size)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runner runs an external command and returns its stdout and stderr.
+// All device commands go through runner so they can be recorded and
+// replayed; only the interactive fzf is executed directly.
+type Runner interface {
+	Run(ctx context.Context, name string, args ...string) (stdout, stderr string, err error)
+}
+
+var runner Runner = execRunner{}
+
+// execRunner runs commands for real.
+type execRunner struct{}
+
+func (execRunner) Run(ctx context.Context, name string, args ...string) (string, string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var out bytes.Buffer
+	var errb bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errb
+	err := cmd.Run()
+	return out.String(), errb.String(), err
+}
+
+// timeoutError is returned for a command killed because its context's
+// deadline passed, instead of the unhelpful "signal: killed". After is the
+// timeout the caller set, not how long the command itself ran.
+type timeoutError struct {
+	Cmd   string
+	After time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.Cmd, e.After)
+}
+
+func (e *timeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+// timeoutKey holds the timeout given to withTimeout.
+type timeoutKey struct{}
+
+type timeoutBudget struct {
+	d        time.Duration
+	deadline time.Time
+}
+
+// withTimeout is context.WithTimeout that remembers d, so a command killed
+// by the deadline can be reported as timing out after d.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if parent, ok := ctx.Deadline(); ok && parent.Before(time.Now().Add(d)) {
+		// the parent's deadline comes first and stays the one to report
+		return context.WithTimeout(ctx, d)
+	}
+	ctx, cancel := context.WithTimeout(ctx, d)
+	deadline, _ := ctx.Deadline()
+	return context.WithValue(ctx, timeoutKey{}, timeoutBudget{d, deadline}), cancel
+}
+
+// timeoutOf returns the timeout behind ctx's deadline: the one given to
+// withTimeout when that set the deadline, otherwise the time that was left
+// when the command started at start.
+func timeoutOf(ctx context.Context, start time.Time) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	if b, ok := ctx.Value(timeoutKey{}).(timeoutBudget); ok && b.deadline.Equal(deadline) {
+		return b.d
+	}
+	return deadline.Sub(start).Round(time.Millisecond)
+}
+
+// contextError maps the error of a command started at start and killed
+// by ctx to one saying why: a timeoutError, or context.Canceled wrapped
+// with the command name. Other errors are returned as they are.
+func contextError(ctx context.Context, name string, start time.Time, err error) error {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return &timeoutError{Cmd: name, After: timeoutOf(ctx, start)}
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("%s: %w", name, context.Canceled)
+	}
+	return err
+}
+
+// recording is one captured command, stored as a JSON file.
+type recording struct {
+	Name   string   `json:"name"`
+	Args   []string `json:"args"`
+	Stdout string   `json:"stdout"`
+	Stderr string   `json:"stderr"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// recordingFile names the file for a command. Probes run concurrently, so
+// recordings are keyed by the command line rather than by call order.
+func recordingFile(dir, name string, args []string) string {
+	sum := sha1.Sum([]byte(name + "\x00" + strings.Join(args, "\x00")))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// recordRunner runs commands with next and saves each one to dir, for
+// --record.
+type recordRunner struct {
+	next Runner
+	dir  string
+	mu   sync.Mutex
+}
+
+func (r *recordRunner) Run(ctx context.Context, name string, args ...string) (string, string, error) {
+	stdout, stderr, err := r.next.Run(ctx, name, args...)
+	rec := recording{Name: name, Args: args, Stdout: stdout, Stderr: stderr}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	b, jerr := json.MarshalIndent(rec, "", "  ")
+	if jerr == nil {
+		r.mu.Lock()
+		jerr = os.WriteFile(recordingFile(r.dir, name, args), b, 0o644)
+		r.mu.Unlock()
+	}
+	if jerr != nil {
+		fmt.Fprintln(os.Stderr, "cannot save recording:", jerr)
+	}
+	return stdout, stderr, err
+}
+
+// replayRunner answers commands from a --record bundle without running
+// anything, for --replay.
+type replayRunner struct {
+	dir string
+}
+
+func (r replayRunner) Run(ctx context.Context, name string, args ...string) (string, string, error) {
+	b, err := os.ReadFile(recordingFile(r.dir, name, args))
+	if err != nil {
+		return "", "", fmt.Errorf("no recording for %s %s", name, strings.Join(args, " "))
+	}
+	var rec recording
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return "", "", err
+	}
+	if rec.Error != "" {
+		return rec.Stdout, rec.Stderr, errors.New(rec.Error)
+	}
+	return rec.Stdout, rec.Stderr, nil
+}
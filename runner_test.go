@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRunner answers commands with fn and records every command line.
+type fakeRunner struct {
+	fn func(ctx context.Context, name string, args []string) (stdout, stderr string, err error)
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (f *fakeRunner) Run(ctx context.Context, name string, args ...string) (string, string, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, strings.Join(append([]string{name}, args...), " "))
+	f.mu.Unlock()
+	return f.fn(ctx, name, args)
+}
+
+// called returns the recorded commands starting with prefix.
+func (f *fakeRunner) called(prefix string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for _, c := range f.calls {
+		if strings.HasPrefix(c, prefix) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// useRunner installs r as the runner for the rest of the test.
+func useRunner(t *testing.T, r Runner) {
+	t.Helper()
+	old := runner
+	runner = r
+	t.Cleanup(func() { runner = old })
+}
+
+// blockingRunner never finishes a command on its own: it returns what
+// exec does for a process killed by its context.
+func blockingRunner() *fakeRunner {
+	return &fakeRunner{fn: func(ctx context.Context, name string, args []string) (string, string, error) {
+		<-ctx.Done()
+		return "", "", errors.New("signal: killed")
+	}}
+}
+
+func TestRunCmdTimeout(t *testing.T) {
+	useRunner(t, blockingRunner())
+
+	ctx, cancel := withTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := runCmd(ctx, "aapt", "dump", "badging", "base.apk")
+	var te *timeoutError
+	if !errors.As(err, &te) {
+		t.Fatalf("err = %v, want a timeoutError", err)
+	}
+	if te.After != 50*time.Millisecond {
+		t.Errorf("After = %v, want the 50ms timeout", te.After)
+	}
+	if got, want := err.Error(), "aapt timed out after 50ms"; got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("timeoutError does not wrap context.DeadlineExceeded")
+	}
+}
+
+func TestRunCmdTimeoutAfterEarlierCommands(t *testing.T) {
+	// a command started late in a probe still reports the probe's budget
+	slow := &fakeRunner{fn: func(ctx context.Context, name string, args []string) (string, string, error) {
+		if name == "pm" {
+			time.Sleep(30 * time.Millisecond)
+			return "package:/data/app/base.apk", "", nil
+		}
+		<-ctx.Done()
+		return "", "", errors.New("signal: killed")
+	}}
+	useRunner(t, slow)
+
+	ctx, cancel := withTimeout(context.Background(), 60*time.Millisecond)
+	defer cancel()
+	if _, err := runCmd(ctx, "pm", "path", "com.foo"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := runCmd(ctx, "aapt", "dump", "badging", "base.apk")
+	if got, want := err.Error(), "aapt timed out after 60ms"; got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+}
+
+func TestRunCmdInheritedDeadline(t *testing.T) {
+	useRunner(t, blockingRunner())
+
+	// the outer deadline comes first, so the inner timeout is not the one
+	// that expired
+	outer, cancel := withTimeout(context.Background(), 40*time.Millisecond)
+	defer cancel()
+	ctx, cancel2 := withTimeout(outer, time.Hour)
+	defer cancel2()
+	_, err := runCmd(ctx, "am", "start")
+	var te *timeoutError
+	if !errors.As(err, &te) {
+		t.Fatalf("err = %v, want a timeoutError", err)
+	}
+	if te.After != 40*time.Millisecond {
+		t.Errorf("After = %v, want the outer 40ms", te.After)
+	}
+}
+
+func TestRunCmdCancelled(t *testing.T) {
+	useRunner(t, blockingRunner())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := runCmd(ctx, "am", "start")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	var te *timeoutError
+	if errors.As(err, &te) {
+		t.Errorf("cancellation reported as timeout: %v", err)
+	}
+}
+
+func TestRunCmdOtherError(t *testing.T) {
+	fail := errors.New("exit status 1")
+	useRunner(t, &fakeRunner{fn: func(ctx context.Context, name string, args []string) (string, string, error) {
+		return "", "Error: unknown command", fail
+	}})
+	out, err := runCmd(context.Background(), "pm", "frobnicate")
+	if !errors.Is(err, fail) {
+		t.Errorf("err = %v, want the command's own error", err)
+	}
+	if out != "Error: unknown command" {
+		t.Errorf("out = %q, want stderr", out)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// compareFunc orders two apps, returning a negative number, zero or a
+// positive number like strings.Compare.
+type compareFunc func(a, b *AppInfo) int
+
+// sortKey returns the comparator for a --sort mode or sortTiebreak name.
+func sortKey(name string, h history) (compareFunc, error) {
+	switch name {
+	case "label":
+		return func(a, b *AppInfo) int {
+			return strings.Compare(strings.ToLower(a.Label), strings.ToLower(b.Label))
+		}, nil
+	case "package":
+		return func(a, b *AppInfo) int {
+			return strings.Compare(a.Package, b.Package)
+		}, nil
+	case "frequent":
+		return func(a, b *AppInfo) int {
+			return cmp.Compare(h.count(b.Package), h.count(a.Package))
+		}, nil
+	case "smart":
+		hour := time.Now().Hour()
+		return func(a, b *AppInfo) int {
+			return cmp.Compare(h.hourScore(b.Package, hour), h.hourScore(a.Package, hour))
+		}, nil
+	case "recent":
+		return func(a, b *AppInfo) int {
+			return h.last(b.Package).Compare(h.last(a.Package))
+		}, nil
+	case "usage":
+		return func(a, b *AppInfo) int {
+			return cmp.Compare(usageScore(b.Package, h), usageScore(a.Package, h))
+		}, nil
+	case "labellen":
+		return func(a, b *AppInfo) int {
+			return cmp.Compare(utf8.RuneCountInString(a.Label), utf8.RuneCountInString(b.Label))
+		}, nil
+	case "icon":
+		return func(a, b *AppInfo) int {
+			return cmp.Compare(boolInt(a.Icon == ""), boolInt(b.Icon == ""))
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown sort key %q (want label, package, frequent, recent, smart, usage, labellen or icon)", name)
+}
+
+// unlaunchableLast puts apps without a launcher activity after all others.
+func unlaunchableLast(a, b *AppInfo) int {
+	return cmp.Compare(boolInt(a.Main == "UNKNOWN_MAIN"), boolInt(b.Main == "UNKNOWN_MAIN"))
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// sortApps orders apps by mode, breaking ties by tiebreak and finally by
+// package name so the order is fully deterministic. With launchableFirst
+// apps are partitioned into launchable and unlaunchable ones before any of
+// that applies.
+func sortApps(apps []*AppInfo, mode, tiebreak string, launchableFirst bool, h history) error {
+	var keys []compareFunc
+	if launchableFirst {
+		keys = append(keys, unlaunchableLast)
+	}
+	for _, name := range []string{mode, tiebreak, "package"} {
+		k, err := sortKey(name, h)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k)
+	}
+	sort.SliceStable(apps, func(i, j int) bool {
+		for _, k := range keys {
+			if c := k(apps[i], apps[j]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+var sortModes = []string{"label", "package", "frequent", "smart", "recent", "usage", "labellen", "icon"}
+
+// sortFixture is a set of apps that tie with each other on every sort key
+// in some pair, so each tie-break has something to decide.
+func sortFixture() ([]*AppInfo, history) {
+	now := time.Now()
+	hour := now.Hour()
+	var hours [24]int
+	hours[hour] = 3
+	apps := []*AppInfo{
+		{Label: "beta", Package: "com.d", Main: ".M", Icon: "ic.png"},
+		{Label: "Alpha", Package: "com.c", Main: "UNKNOWN_MAIN"},
+		{Label: "beta", Package: "com.b", Main: ".M"},
+		{Label: "gamma", Package: "com.a", Main: ".M", Icon: "ic.png"},
+		{Label: "Alpha", Package: "com.e", Main: ".M", Icon: "ic.png"},
+	}
+	h := history{
+		"com.a": {Count: 2, Last: now.Add(-time.Hour), Hours: hours},
+		"com.b": {Count: 2, Last: now.Add(-time.Hour)},
+		"com.e": {Count: 5, Last: now, Hours: hours},
+	}
+	return apps, h
+}
+
+func TestSortAppsTiebreaks(t *testing.T) {
+	for _, mode := range sortModes {
+		for _, tb := range sortModes {
+			for _, first := range []bool{false, true} {
+				apps, h := sortFixture()
+				if err := sortApps(apps, mode, tb, first, h); err != nil {
+					t.Fatal(err)
+				}
+				var keys []compareFunc
+				if first {
+					keys = append(keys, unlaunchableLast)
+				}
+				for _, name := range []string{mode, tb, "package"} {
+					k, _ := sortKey(name, h)
+					keys = append(keys, k)
+				}
+				for i := 1; i < len(apps); i++ {
+					a, b := apps[i-1], apps[i]
+					c := 0
+					for _, k := range keys {
+						if c = k(a, b); c != 0 {
+							break
+						}
+					}
+					if c >= 0 {
+						t.Errorf("--sort=%s --sort-tiebreak=%s launchable-first=%v: %s before %s",
+							mode, tb, first, a.Package, b.Package)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSortAppsOrder(t *testing.T) {
+	tests := []struct {
+		mode, tiebreak string
+		first          bool
+		want           []string
+	}{
+		{"label", "label", false, []string{"com.c", "com.e", "com.b", "com.d", "com.a"}},
+		{"label", "icon", false, []string{"com.e", "com.c", "com.d", "com.b", "com.a"}},
+		{"label", "frequent", true, []string{"com.e", "com.b", "com.d", "com.a", "com.c"}},
+		{"frequent", "label", false, []string{"com.e", "com.b", "com.a", "com.c", "com.d"}},
+		{"frequent", "package", false, []string{"com.e", "com.a", "com.b", "com.c", "com.d"}},
+		{"recent", "label", false, []string{"com.e", "com.b", "com.a", "com.c", "com.d"}},
+		{"smart", "labellen", false, []string{"com.a", "com.e", "com.b", "com.d", "com.c"}},
+		{"icon", "recent", false, []string{"com.e", "com.a", "com.d", "com.b", "com.c"}},
+		{"labellen", "frequent", false, []string{"com.b", "com.d", "com.e", "com.a", "com.c"}},
+		{"package", "label", true, []string{"com.a", "com.b", "com.d", "com.e", "com.c"}},
+	}
+	for _, tt := range tests {
+		apps, h := sortFixture()
+		if err := sortApps(apps, tt.mode, tt.tiebreak, tt.first, h); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, a := range apps {
+			got = append(got, a.Package)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("--sort=%s --sort-tiebreak=%s launchable-first=%v: %q, want %q",
+				tt.mode, tt.tiebreak, tt.first, got, tt.want)
+		}
+	}
+}
+
+func TestSortAppsUnknownKey(t *testing.T) {
+	apps, h := sortFixture()
+	if err := sortApps(apps, "label", "size", false, h); err == nil {
+		t.Error("sortApps accepted an unknown tie-break")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stateDir returns the directory for small persistent files such as the
+// last fzf query, following the XDG base directory spec.
+func stateDir() (string, error) {
+	if d := os.Getenv("XDG_STATE_HOME"); d != "" {
+		return filepath.Join(d, "drawercli"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "drawercli"), nil
+}
+
+// stateFile returns the path of a state file for the active Android user,
+// so history and queries from different profiles never mix.
+func stateFile(name string) (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "user"+androidUser, name), nil
+}
+
+// readState returns the trimmed contents of a state file, or "" if it
+// does not exist.
+func readState(name string) (string, error) {
+	p, err := stateFile(name)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func writeState(name, data string) error {
+	p, err := stateFile(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, []byte(data+"\n"), 0o644)
+}
+
+// boolState encodes a flag for a state file.
+func boolState(b bool) string {
+	if b {
+		return "1"
+	}
+	return ""
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// useUser switches androidUser for the duration of a test.
+func useUser(t *testing.T, id string) {
+	t.Helper()
+	old := androidUser
+	androidUser = id
+	t.Cleanup(func() { androidUser = old })
+}
+
+func TestStateFilePerUser(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+
+	useUser(t, "0")
+	if err := writeState("last_query", "owner"); err != nil {
+		t.Fatal(err)
+	}
+	p0, err := stateFile("last_query")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	useUser(t, "10")
+	p10, err := stateFile("last_query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p0 == p10 {
+		t.Fatalf("users 0 and 10 share %s", p0)
+	}
+	if want := filepath.Join(dir, "drawercli", "user10", "last_query"); p10 != want {
+		t.Errorf("stateFile = %s, want %s", p10, want)
+	}
+	if got, err := readState("last_query"); err != nil || got != "" {
+		t.Errorf("user 10 read %q, %v; want the owner's query hidden", got, err)
+	}
+	if err := writeState("last_query", "work"); err != nil {
+		t.Fatal(err)
+	}
+
+	useUser(t, "0")
+	if got, _ := readState("last_query"); got != "owner" {
+		t.Errorf("user 0 read %q after user 10 wrote, want %q", got, "owner")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// usageTimes is the foreground time per package read from usagestats for
+// --sort=usage; nil when it could not be read.
+var usageTimes map[string]time.Duration
+
+// loadUsage reads foreground times with `dumpsys usagestats`. That needs
+// the PACKAGE_USAGE_STATS permission, which is often denied; the error is
+// returned so the caller can fall back.
+func loadUsage(ctx context.Context) (map[string]time.Duration, error) {
+	dctx, cancel := withTimeout(ctx, 15*time.Second)
+	defer cancel()
+	out, err := runCmd(dctx, "dumpsys", "usagestats")
+	if err != nil {
+		return nil, err
+	}
+	if line := firstLineContaining(out, "Permission Denial"); line != "" {
+		return nil, errors.New(strings.TrimSpace(line))
+	}
+	return parseUsage(out), nil
+}
+
+// parseUsage extracts totalTimeUsed from the package lines of usagestats,
+//
+//	package=com.foo totalTimeUsed="01:02:03" lastTimeUsed="2024-03-01 12:00:00"
+//
+// The dump repeats each package for the daily, weekly, monthly and yearly
+// intervals; the longest interval's time, the largest, is kept.
+func parseUsage(out string) map[string]time.Duration {
+	usage := map[string]time.Duration{}
+	sc := bufio.NewScanner(strings.NewReader(out))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		pkg, total := "", time.Duration(-1)
+		for _, f := range strings.Fields(sc.Text()) {
+			k, v, ok := strings.Cut(f, "=")
+			if !ok {
+				continue
+			}
+			switch k {
+			case "package":
+				pkg = v
+			case "totalTimeUsed":
+				total = parseClock(strings.Trim(v, `"`))
+			}
+		}
+		if pkg != "" && total > usage[pkg] {
+			usage[pkg] = total
+		}
+	}
+	return usage
+}
+
+// parseClock parses the "[[hh:]mm:]ss" durations of usagestats, or returns
+// -1.
+func parseClock(s string) time.Duration {
+	var d time.Duration
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return -1
+		}
+		d = d*60 + time.Duration(n)
+	}
+	return d * time.Second
+}
+
+// launchWeight is the foreground time one launch counts for in the usage
+// score, so apps opened often but briefly are not buried.
+const launchWeight = 5 * time.Minute
+
+// usageScore blends foreground time with the launch count. Without
+// usagestats only the launch count is left, as --sort=frequent.
+func usageScore(pkg string, h history) time.Duration {
+	return usageTimes[pkg] + time.Duration(h.count(pkg))*launchWeight
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// workerCandidates are the probe concurrency levels calibration compares.
+var workerCandidates = []int{4, 8, 16}
+
+// probeCalibrated probes pkgs with the worker count cached in the state
+// dir. Without a cached count, or with recalibrate, the first packages are
+// probed in one batch per candidate count, the count with the lowest time
+// per package is used for the rest and saved for later runs. The batches
+// are real probes, so calibrating costs no extra commands.
+func probeCalibrated(ctx context.Context, pkgs []string, launchers map[string]string, recalibrate bool) []*AppInfo {
+	if !recalibrate {
+		if s, err := readState("workers"); err == nil && s != "" {
+			if n, err := strconv.Atoi(s); err == nil && n > 0 {
+				return probeAll(ctx, pkgs, n, launchers)
+			}
+		}
+	}
+
+	need := 0
+	for _, c := range workerCandidates {
+		need += 2 * c
+	}
+	if len(pkgs) < need {
+		// too few packages to tell the counts apart
+		return probeAll(ctx, pkgs, probeLimit(), launchers)
+	}
+
+	var apps []*AppInfo
+	best, bestPer := 0, time.Duration(0)
+	rest := pkgs
+	for _, c := range workerCandidates {
+		batch := rest[:2*c]
+		rest = rest[2*c:]
+		start := time.Now()
+		apps = append(apps, probeAll(ctx, batch, c, launchers)...)
+		per := time.Since(start) / time.Duration(len(batch))
+		if best == 0 || per < bestPer {
+			best, bestPer = c, per
+		}
+	}
+	if err := writeState("workers", strconv.Itoa(best)); err != nil {
+		fmt.Fprintln(os.Stderr, "cannot save worker count:", err)
+	}
+	return append(apps, probeAll(ctx, rest, best, launchers)...)
+}